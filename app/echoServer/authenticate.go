@@ -0,0 +1,89 @@
+// app/echoServer/authenticate.go
+package echoServer
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	sessionsvc "instagram/service/session"
+	tokensvc "instagram/service/token"
+	"instagram/util/auth"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Authenticate resolves the caller from the Authorization header, with or
+// without the Bearer scheme, and stores it in the request context for
+// auth.From. The header holds a login JWT or a personal access token
+// ("igp_..."). A login JWT is only good while its session is live.
+//
+// An access token only reaches routes listed in tokenScopes, and only if
+// it grants the scope listed; everything else, including token and
+// account management, needs a login.
+func Authenticate(tokens *auth.Tokens, pats tokensvc.Service, sessions sessionsvc.Service) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			raw := bearerToken(req.Header.Get(echo.HeaderAuthorization))
+			if raw == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+			}
+
+			var p *auth.Principal
+			if strings.HasPrefix(raw, tokensvc.Prefix) {
+				t, err := pats.Authenticate(ctx, raw)
+				if errors.Is(err, tokensvc.ErrInvalidToken) {
+					return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+				}
+				if err != nil {
+					logger.From(ctx).Error("access token lookup failed", "err", err)
+					return echo.NewHTTPError(http.StatusInternalServerError)
+				}
+
+				scope, ok := tokenScopes[req.Method+" "+c.Path()]
+				if !ok {
+					return echo.NewHTTPError(http.StatusForbidden, "not available to access tokens")
+				}
+				if !t.HasScope(scope) {
+					return echo.NewHTTPError(http.StatusForbidden, "token lacks scope "+scope)
+				}
+				p = &auth.Principal{UserID: t.UserID, Scopes: t.Scopes, TokenID: t.ID}
+			} else {
+				var err error
+				if p, err = tokens.Verify(raw); err != nil {
+					logger.From(ctx).Debug("login token rejected", "err", err)
+					return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+				}
+				err = sessions.Check(ctx, p.SessionID, p.UserID)
+				if errors.Is(err, sessionsvc.ErrEnded) {
+					return echo.NewHTTPError(http.StatusUnauthorized, sessionsvc.ErrEnded.Error())
+				}
+				if err != nil {
+					logger.From(ctx).Error("session lookup failed", "err", err)
+					return echo.NewHTTPError(http.StatusInternalServerError)
+				}
+			}
+
+			ctx = auth.WithPrincipal(ctx, p)
+			c.SetRequest(req.WithContext(logger.Append(ctx, "user_id", p.UserID)))
+			return next(c)
+		}
+	}
+}
+
+// principal is the caller set by Authenticate.
+func principal(c echo.Context) (*auth.Principal, bool) {
+	return auth.From(c.Request().Context())
+}
+
+// bearerToken extracts the token from the Authorization header.
+func bearerToken(header string) string {
+	tok := strings.TrimSpace(header)
+	if scheme, rest, ok := strings.Cut(tok, " "); ok && strings.EqualFold(scheme, "bearer") {
+		tok = strings.TrimSpace(rest)
+	}
+	return tok
+}
@@ -1,8 +1,18 @@
 package controller
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"instagram/model"
 	activitysvc "instagram/service/activity"
+	"instagram/util/logger"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -15,16 +25,225 @@ func NewActivityController(s activitysvc.Service) *ActivityController { return &
 
 // List my activities
 // @Summary      My activities
+// @Description  Newest first. Follow next_before_id to page through older entries.
 // @Security     BearerAuth
 // @Tags         activities
 // @Produce      json
-// @Success      200  {array}  model.Activity
+// @Param        action       query  string  false  "Action"  Enums(POST_CREATE, POST_DELETE, POST_RESTORE, LIKE_CREATE, LIKE_DELETE, DATA_EXPORT, LOGIN_NEW_DEVICE)
+// @Param        target_type  query  string  false  "Target type"  Enums(post, data_export, session)
+// @Param        target_id    query  int     false  "Target ID"
+// @Param        from         query  string  false  "Created at or after (RFC 3339)"
+// @Param        to           query  string  false  "Created before (RFC 3339)"
+// @Param        before_id    query  int     false  "Return entries older than this ID"
+// @Param        limit        query  int     false  "Page size (1-200, default 50)"
+// @Success      200  {object}  model.ActivityPage
+// @Failure      400  {object}  map[string]any "invalid filter"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      500  {object}  map[string]any "internal server error"
 // @Router       /v1/activities [get]
 func (ct *ActivityController) ListMine(c echo.Context) error {
-	uid := c.Get("uid").(int64)
-	acts, err := ct.s.ListMine(c.Request().Context(), uid)
+	uid, err := currentUserID(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": err.Error()})
+		return err
 	}
-	return c.JSON(http.StatusOK, acts)
+	f, err := bindActivityFilter(c)
+	if err != nil {
+		return err
+	}
+	page, err := ct.s.ListMine(c.Request().Context(), uid, f)
+	if err != nil {
+		logger.From(c.Request().Context()).Error("list activities failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func bindActivityFilter(c echo.Context) (model.ActivityFilter, error) {
+	var f model.ActivityFilter
+	var action string
+	err := echo.QueryParamsBinder(c).
+		String("action", &action).
+		String("target_type", &f.TargetType).
+		Int64("target_id", &f.TargetID).
+		Time("from", &f.From, time.RFC3339).
+		Time("to", &f.To, time.RFC3339).
+		Int64("before_id", &f.BeforeID).
+		Int("limit", &f.Limit).
+		BindError()
+	if err != nil {
+		var be *echo.BindingError
+		if errors.As(err, &be) {
+			return f, echo.NewHTTPError(http.StatusBadRequest, "invalid "+be.Field)
+		}
+		return f, echo.NewHTTPError(http.StatusBadRequest, "invalid filter")
+	}
+	f.Action = model.ActivityAction(action)
+	if err := c.Validate(&f); err != nil {
+		return f, echo.NewHTTPError(http.StatusBadRequest, "invalid filter")
+	}
+	return f, nil
+}
+
+// Export my activities
+// @Summary      Export my activities
+// @Description  Download the full activity history, oldest first, as CSV or NDJSON. Accepts the same filters as GET /v1/activities.
+// @Security     BearerAuth
+// @Tags         activities
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        format       query  string  false  "File format"  Enums(csv, ndjson)  default(csv)
+// @Param        action       query  string  false  "Action"  Enums(POST_CREATE, POST_DELETE, POST_RESTORE, LIKE_CREATE, LIKE_DELETE, DATA_EXPORT, LOGIN_NEW_DEVICE)
+// @Param        target_type  query  string  false  "Target type"  Enums(post, data_export, session)
+// @Param        target_id    query  int     false  "Target ID"
+// @Param        from         query  string  false  "Created at or after (RFC 3339)"
+// @Param        to           query  string  false  "Created before (RFC 3339)"
+// @Success      200  {file}    file
+// @Failure      400  {object}  map[string]any "invalid filter or format"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/activities/export [get]
+func (ct *ActivityController) Export(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	f, err := bindActivityFilter(c)
+	if err != nil {
+		return err
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	var w activityWriter
+	switch format {
+	case "csv":
+		w = newCSVActivityWriter(c.Response())
+	case "ndjson":
+		w = newNDJSONActivityWriter(c.Response())
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be csv or ndjson")
+	}
+
+	res := c.Response()
+	filename := fmt.Sprintf("activities-%d-%s.%s", uid, time.Now().UTC().Format("20060102"), format)
+	// Headers go out with the first row, so a query that fails before
+	// producing anything can still become a proper error response.
+	start := func() error {
+		res.Header().Set(echo.HeaderContentType, w.ContentType())
+		res.Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		res.WriteHeader(http.StatusOK)
+		return w.Begin()
+	}
+
+	ctx := c.Request().Context()
+	rows := 0
+	err = ct.s.ExportMine(ctx, uid, f, func(a model.Activity) error {
+		if rows == 0 {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		rows++
+		if err := w.Write(a); err != nil {
+			return err
+		}
+		if rows%500 == 0 {
+			return w.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !res.Committed {
+			logger.From(ctx).Error("export activities failed", "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		// Too late for a status code; dropping the connection at least
+		// keeps a truncated file from looking complete.
+		logger.From(ctx).Error("export activities aborted", "rows", rows, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	if rows == 0 {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// activityWriter encodes exported activities onto the response.
+type activityWriter interface {
+	ContentType() string
+	Begin() error
+	Write(a model.Activity) error
+	Flush() error
+}
+
+type csvActivityWriter struct {
+	res *echo.Response
+	w   *csv.Writer
+}
+
+func newCSVActivityWriter(res *echo.Response) *csvActivityWriter {
+	return &csvActivityWriter{res: res, w: csv.NewWriter(res)}
+}
+
+func (w *csvActivityWriter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (w *csvActivityWriter) Begin() error {
+	return w.w.Write([]string{"id", "action", "description", "target_type", "target_id", "created_at"})
+}
+
+func (w *csvActivityWriter) Write(a model.Activity) error {
+	targetID := ""
+	if a.Metadata.TargetID != 0 {
+		targetID = strconv.FormatInt(a.Metadata.TargetID, 10)
+	}
+	return w.w.Write([]string{
+		strconv.FormatInt(a.ID, 10),
+		string(a.Action),
+		csvSafe(a.Description),
+		a.Metadata.TargetType,
+		targetID,
+		a.CreatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (w *csvActivityWriter) Flush() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// csvSafe keeps spreadsheet apps from running user-controlled text (post
+// titles end up in descriptions) as a formula.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type ndjsonActivityWriter struct {
+	res *echo.Response
+	enc *json.Encoder
+}
+
+func newNDJSONActivityWriter(res *echo.Response) *ndjsonActivityWriter {
+	return &ndjsonActivityWriter{res: res, enc: json.NewEncoder(res)}
+}
+
+func (w *ndjsonActivityWriter) ContentType() string { return "application/x-ndjson" }
+
+func (w *ndjsonActivityWriter) Begin() error { return nil }
+
+func (w *ndjsonActivityWriter) Write(a model.Activity) error { return w.enc.Encode(a) }
+
+func (w *ndjsonActivityWriter) Flush() error {
+	w.res.Flush()
+	return nil
 }
@@ -0,0 +1,122 @@
+// app/echoServer/controller/exportController.go
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	exportsvc "instagram/service/export"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ExportController struct{ s exportsvc.Service }
+
+func NewExportController(s exportsvc.Service) *ExportController { return &ExportController{s} }
+
+// exportError maps exportsvc sentinels to HTTP errors.
+func exportError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, exportsvc.ErrInProgress):
+		return echo.NewHTTPError(http.StatusConflict, exportsvc.ErrInProgress.Error())
+	case errors.Is(err, exportsvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, exportsvc.ErrNotFound.Error())
+	case errors.Is(err, exportsvc.ErrNotReady):
+		return echo.NewHTTPError(http.StatusConflict, exportsvc.ErrNotReady.Error())
+	case errors.Is(err, exportsvc.ErrBadSignature):
+		return echo.NewHTTPError(http.StatusForbidden, exportsvc.ErrBadSignature.Error())
+	case errors.Is(err, exportsvc.ErrLinkExpired):
+		return echo.NewHTTPError(http.StatusGone, exportsvc.ErrLinkExpired.Error())
+	default:
+		logger.From(c.Request().Context()).Error("data export request failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
+
+// Request a data export
+// @Summary      Request data export
+// @Description  Queue a ZIP archive of everything held about the caller (profile, posts, likes given and received, activity). Poll the status endpoint for the download link.
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Success      202  {object}  model.DataExport
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      409  {object}  map[string]any "export already in progress"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/export [post]
+func (ct *ExportController) Request(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	e, err := ct.s.Request(c.Request().Context(), uid)
+	if err != nil {
+		return exportError(c, err)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/v1/users/me/export/%d", e.ID))
+	return c.JSON(http.StatusAccepted, e)
+}
+
+// Data export status
+// @Summary      Data export status
+// @Description  Once status is "ready" the response carries a signed download_url valid until url_expires_at; fetch this again for a fresh link.
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Param        id   path  int  true  "Export ID"
+// @Success      200  {object}  model.DataExport
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "export not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/export/{id} [get]
+func (ct *ExportController) Status(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	e, err := ct.s.Status(c.Request().Context(), id, uid)
+	if err != nil {
+		return exportError(c, err)
+	}
+	return c.JSON(http.StatusOK, e)
+}
+
+// Download a data export
+// @Summary      Download data export
+// @Description  Signed link from the status endpoint; no bearer token needed.
+// @Tags         users
+// @Produce      application/zip
+// @Param        id       path   int     true  "Export ID"
+// @Param        expires  query  int     true  "Link expiry (unix seconds)"
+// @Param        sig      query  string  true  "Link signature"
+// @Success      200  {file}    file
+// @Failure      400  {object}  map[string]any "invalid link"
+// @Failure      403  {object}  map[string]any "invalid download link"
+// @Failure      404  {object}  map[string]any "export not found"
+// @Failure      409  {object}  map[string]any "export is not ready"
+// @Failure      410  {object}  map[string]any "download link expired"
+// @Router       /v1/exports/{id}/download [get]
+func (ct *ExportController) Download(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid link")
+	}
+	e, err := ct.s.Open(c.Request().Context(), id, expires, c.QueryParam("sig"))
+	if err != nil {
+		return exportError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "private, no-store")
+	return c.Attachment(e.FilePath, fmt.Sprintf("instagram-export-%d.zip", e.ID))
+}
@@ -0,0 +1,41 @@
+// app/echoServer/controller/healthController.go
+package controller
+
+import (
+	"net/http"
+
+	healthsvc "instagram/service/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthController struct{ s healthsvc.Service }
+
+func NewHealthController(s healthsvc.Service) *HealthController { return &HealthController{s} }
+
+// Liveness probe
+// @Summary      Liveness
+// @Description  Reports that the process is running; never touches dependencies
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]any
+// @Router       /livez [get]
+func (ct *HealthController) Livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": healthsvc.StatusUp})
+}
+
+// Readiness probe
+// @Summary      Readiness
+// @Description  Pings the database pool and the joke upstream; 503 when a critical dependency is down
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  healthsvc.Report
+// @Failure      503  {object}  healthsvc.Report
+// @Router       /readyz [get]
+func (ct *HealthController) Readyz(c echo.Context) error {
+	rep := ct.s.Ready(c.Request().Context())
+	if rep.Status == healthsvc.StatusDown {
+		return c.JSON(http.StatusServiceUnavailable, rep)
+	}
+	return c.JSON(http.StatusOK, rep)
+}
@@ -0,0 +1,128 @@
+// app/echoServer/controller/jobController.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"instagram/model"
+	jobsvc "instagram/service/job"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type JobController struct{ s jobsvc.Service }
+
+func NewJobController(s jobsvc.Service) *JobController { return &JobController{s} }
+
+// jobError maps jobsvc sentinels to HTTP errors.
+func jobError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, jobsvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, jobsvc.ErrNotFound.Error())
+	case errors.Is(err, jobsvc.ErrNotDead):
+		return echo.NewHTTPError(http.StatusConflict, jobsvc.ErrNotDead.Error())
+	default:
+		logger.From(c.Request().Context()).Error("job request failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
+
+// List background jobs
+// @Summary      List background jobs
+// @Description  Admin only. Newest first; pass next_before_id back as before_id for the next page.
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        status     query  string  false  "Status"  Enums(queued, running, done, dead)
+// @Param        kind       query  string  false  "Job kind"
+// @Param        before_id  query  int     false  "Only jobs with a smaller ID"
+// @Param        limit      query  int     false  "Page size (1-200, default 50)"
+// @Success      200  {object}  model.JobPage
+// @Failure      400  {object}  map[string]any "invalid filter"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not an admin"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/admin/jobs [get]
+func (ct *JobController) List(c echo.Context) error {
+	var f model.JobFilter
+	var status string
+	err := echo.QueryParamsBinder(c).
+		String("status", &status).
+		String("kind", &f.Kind).
+		Int64("before_id", &f.BeforeID).
+		Int("limit", &f.Limit).
+		BindError()
+	if err != nil {
+		var be *echo.BindingError
+		if errors.As(err, &be) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid "+be.Field)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid filter")
+	}
+	f.Status = model.JobStatus(status)
+	if err := c.Validate(&f); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid filter")
+	}
+
+	page, err := ct.s.List(c.Request().Context(), f)
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// Background job detail
+// @Summary      Background job detail
+// @Description  Admin only.
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path  int  true  "Job ID"
+// @Success      200  {object}  model.Job
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not an admin"
+// @Failure      404  {object}  map[string]any "job not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/admin/jobs/{id} [get]
+func (ct *JobController) Detail(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	j, err := ct.s.Detail(c.Request().Context(), id)
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.JSON(http.StatusOK, j)
+}
+
+// Retry a dead job
+// @Summary      Retry a dead job
+// @Description  Admin only. Queues a dead-lettered job to run now with a fresh set of attempts.
+// @Security     BearerAuth
+// @Tags         admin
+// @Produce      json
+// @Param        id   path  int  true  "Job ID"
+// @Success      200  {object}  model.Job
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not an admin"
+// @Failure      404  {object}  map[string]any "job not found"
+// @Failure      409  {object}  map[string]any "job is not dead"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/admin/jobs/{id}/retry [post]
+func (ct *JobController) Retry(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	j, err := ct.s.Retry(c.Request().Context(), id)
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.JSON(http.StatusOK, j)
+}
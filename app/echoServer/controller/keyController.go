@@ -0,0 +1,28 @@
+// app/echoServer/controller/keyController.go
+package controller
+
+import (
+	"net/http"
+
+	keysvc "instagram/service/key"
+
+	"github.com/labstack/echo/v4"
+)
+
+type KeyController struct{ s keysvc.Service }
+
+func NewKeyController(s keysvc.Service) *KeyController { return &KeyController{s} }
+
+// JSON Web Key Set
+// @Summary      JWT verification keys
+// @Description  Public keys that login tokens are signed with, matched by the token's kid header. Includes the next key before it starts signing.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  jwt.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (ct *KeyController) JWKS(c echo.Context) error {
+	// Short enough that a cached copy sees the next key well before it
+	// starts signing.
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, ct.s.JWKS())
+}
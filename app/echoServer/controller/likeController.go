@@ -2,13 +2,14 @@ package controller
 
 // controller/likeController.go
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"instagram/model"
 	likesvc "instagram/service/like"
+	"instagram/util/logger"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -16,24 +17,25 @@ type LikeController struct{ s likesvc.Service }
 
 func NewLikeController(s likesvc.Service) *LikeController { return &LikeController{s} }
 
-func userIDFromJWT(c echo.Context) (int64, error) {
-	tok, ok := c.Get("user").(*jwt.Token)
-	if !ok || tok == nil {
-		return 0, echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid token")
+// likeError maps likesvc sentinels to HTTP errors.
+func likeError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, likesvc.ErrAlreadyLiked):
+		return echo.NewHTTPError(http.StatusConflict, "post already liked")
+	case errors.Is(err, likesvc.ErrPostNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "post not found")
+	case errors.Is(err, likesvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "like not found")
+	case errors.Is(err, likesvc.ErrNotOwner):
+		return echo.NewHTTPError(http.StatusForbidden, "forbidden: not owner")
+	default:
+		logger.From(c.Request().Context()).Error("like request failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
 	}
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, echo.NewHTTPError(http.StatusUnauthorized, "invalid token claims")
-	}
-	sub, ok := claims["sub"].(float64)
-	if !ok {
-		return 0, echo.NewHTTPError(http.StatusUnauthorized, "invalid subject in token")
-	}
-	return int64(sub), nil
 }
 
 func (ct *LikeController) Create(c echo.Context) error {
-	uid, err := userIDFromJWT(c)
+	uid, err := currentUserID(c)
 	if err != nil {
 		return err
 	}
@@ -53,11 +55,74 @@ func (ct *LikeController) Create(c echo.Context) error {
 
 	lk, err := ct.s.Create(c.Request().Context(), uid, req)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": err.Error()})
+		return likeError(c, err)
 	}
 	return c.JSON(http.StatusCreated, echo.Map{"message": "liked", "data": lk})
 }
 
+// Like a post
+// @Summary      Like post
+// @Description  Idempotently like a post. 201 when the like is new, 200 when it already existed.
+// @Security     BearerAuth
+// @Tags         likes
+// @Produce      json
+// @Param        id   path  int  true  "Post ID"
+// @Success      200  {object}  map[string]any "already liked"
+// @Success      201  {object}  map[string]any "liked"
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "post not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/posts/{id}/like [put]
+func (ct *LikeController) Like(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	postID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	lk, created, err := ct.s.Like(c.Request().Context(), uid, postID)
+	if err != nil {
+		return likeError(c, err)
+	}
+	if created {
+		return c.JSON(http.StatusCreated, echo.Map{"message": "liked", "data": lk})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "already liked", "data": lk})
+}
+
+// Unlike a post
+// @Summary      Unlike post
+// @Description  Idempotently remove the caller's like; succeeds even if the post was not liked.
+// @Security     BearerAuth
+// @Tags         likes
+// @Produce      json
+// @Param        id   path  int  true  "Post ID"
+// @Success      200  {object}  map[string]any "unliked"
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "post not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/posts/{id}/like [delete]
+func (ct *LikeController) Unlike(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	postID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	if err := ct.s.Unlike(c.Request().Context(), uid, postID); err != nil {
+		return likeError(c, err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "unliked", "post_id": postID})
+}
+
 func (ct *LikeController) Detail(c echo.Context) error {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -65,13 +130,13 @@ func (ct *LikeController) Detail(c echo.Context) error {
 	}
 	lk, err := ct.s.Detail(c.Request().Context(), id)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": "like not found"})
+		return likeError(c, err)
 	}
 	return c.JSON(http.StatusOK, lk)
 }
 
 func (ct *LikeController) Delete(c echo.Context) error {
-	uid, err := userIDFromJWT(c)
+	uid, err := currentUserID(c)
 	if err != nil {
 		return err
 	}
@@ -80,7 +145,7 @@ func (ct *LikeController) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid id"})
 	}
 	if err := ct.s.Delete(c.Request().Context(), id, uid); err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": err.Error()})
+		return likeError(c, err)
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "unliked", "id": id})
 }
@@ -0,0 +1,192 @@
+// app/echoServer/controller/mfaController.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"instagram/model"
+	mfasvc "instagram/service/mfa"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type MFAController struct{ s mfasvc.Service }
+
+func NewMFAController(s mfasvc.Service) *MFAController { return &MFAController{s} }
+
+// mfaError maps mfasvc sentinels to HTTP errors.
+func mfaError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, mfasvc.ErrAlreadyEnabled):
+		return echo.NewHTTPError(http.StatusConflict, mfasvc.ErrAlreadyEnabled.Error())
+	case errors.Is(err, mfasvc.ErrNotEnrolled):
+		return echo.NewHTTPError(http.StatusConflict, mfasvc.ErrNotEnrolled.Error())
+	case errors.Is(err, mfasvc.ErrNotEnabled):
+		return echo.NewHTTPError(http.StatusConflict, mfasvc.ErrNotEnabled.Error())
+	case errors.Is(err, mfasvc.ErrInvalidCode):
+		return echo.NewHTTPError(http.StatusUnauthorized, mfasvc.ErrInvalidCode.Error())
+	case errors.Is(err, mfasvc.ErrLocked):
+		return echo.NewHTTPError(http.StatusTooManyRequests, mfasvc.ErrLocked.Error())
+	default:
+		logger.From(c.Request().Context()).Error("two-factor request failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
+
+// bindCode reads and validates a model.MFACodeReq body.
+func bindCode(c echo.Context) (string, error) {
+	var req model.MFACodeReq
+	if err := c.Bind(&req); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "validation error")
+	}
+	return req.Code, nil
+}
+
+// Two-factor status
+// @Summary      Two-factor status
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  model.MFAStatus
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/2fa [get]
+func (ct *MFAController) Status(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	st, err := ct.s.Status(c.Request().Context(), uid)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	return c.JSON(http.StatusOK, st)
+}
+
+// Start two-factor setup
+// @Summary      Start two-factor setup
+// @Description  Generates a new authenticator secret. Show otpauth_uri as a QR code (or the secret for manual entry), then confirm with a code from the app. Calling this again before confirming replaces the secret.
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Success      201  {object}  model.TOTPEnrollment
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      409  {object}  map[string]any "already enabled"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/2fa [post]
+func (ct *MFAController) Enroll(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	en, err := ct.s.Enroll(c.Request().Context(), uid)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusCreated, en)
+}
+
+// Confirm two-factor setup
+// @Summary      Confirm two-factor setup
+// @Description  Turns two-factor authentication on with a code from the authenticator app and returns ten one-time recovery codes. They are only shown here.
+// @Security     BearerAuth
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  model.MFACodeReq  true  "Authenticator code"
+// @Success      200  {object}  model.RecoveryCodes
+// @Failure      400  {object}  map[string]any "validation error"
+// @Failure      401  {object}  map[string]any "missing or invalid token / invalid code"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      409  {object}  map[string]any "already enabled / setup not started"
+// @Failure      429  {object}  map[string]any "too many wrong codes"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/2fa/confirm [post]
+func (ct *MFAController) Confirm(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	code, err := bindCode(c)
+	if err != nil {
+		return err
+	}
+	codes, err := ct.s.Confirm(c.Request().Context(), uid, code)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, model.RecoveryCodes{Codes: codes})
+}
+
+// Disable two-factor authentication
+// @Summary      Disable two-factor authentication
+// @Description  Needs a current authenticator code or an unused recovery code.
+// @Security     BearerAuth
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  model.MFACodeReq  true  "Authenticator or recovery code"
+// @Success      204
+// @Failure      400  {object}  map[string]any "validation error"
+// @Failure      401  {object}  map[string]any "missing or invalid token / invalid code"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      409  {object}  map[string]any "not enabled"
+// @Failure      429  {object}  map[string]any "too many wrong codes"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/2fa/disable [post]
+func (ct *MFAController) Disable(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	code, err := bindCode(c)
+	if err != nil {
+		return err
+	}
+	if err := ct.s.Disable(c.Request().Context(), uid, code); err != nil {
+		return mfaError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Regenerate recovery codes
+// @Summary      Regenerate recovery codes
+// @Description  Replaces all recovery codes, used or not. Needs a current authenticator code or an unused recovery code.
+// @Security     BearerAuth
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  model.MFACodeReq  true  "Authenticator or recovery code"
+// @Success      200  {object}  model.RecoveryCodes
+// @Failure      400  {object}  map[string]any "validation error"
+// @Failure      401  {object}  map[string]any "missing or invalid token / invalid code"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      409  {object}  map[string]any "not enabled"
+// @Failure      429  {object}  map[string]any "too many wrong codes"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/2fa/recovery-codes [post]
+func (ct *MFAController) RegenerateRecoveryCodes(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	code, err := bindCode(c)
+	if err != nil {
+		return err
+	}
+	codes, err := ct.s.RegenerateRecoveryCodes(c.Request().Context(), uid, code)
+	if err != nil {
+		return mfaError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, model.RecoveryCodes{Codes: codes})
+}
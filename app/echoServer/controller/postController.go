@@ -8,8 +8,8 @@ import (
 
 	"instagram/model"
 	postsvc "instagram/service/post"
+	"instagram/util/logger"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -32,19 +32,10 @@ func NewPostController(s postsvc.Service) *PostController { return &PostControll
 // @Router       /v1/posts [post]
 func (ct *PostController) Create(c echo.Context) error {
 
-	tok, ok := c.Get("user").(*jwt.Token)
-	if !ok || tok == nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid token")
-	}
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token claims")
-	}
-	sub, ok := claims["sub"].(float64)
-	if !ok {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid subject in token")
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
 	}
-	userID := int64(sub)
 
 	var req model.CreatePostReq
 	if err := c.Bind(&req); err != nil {
@@ -78,7 +69,11 @@ func (ct *PostController) Create(c echo.Context) error {
 // @Failure      500  {object}  map[string]any "internal server error"
 // @Router       /v1/posts [get]
 func (ct *PostController) List(c echo.Context) error {
-	out, err := ct.s.List(c.Request().Context())
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	out, err := ct.s.List(c.Request().Context(), uid)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -91,33 +86,95 @@ func (ct *PostController) List(c echo.Context) error {
 // @Security     BearerAuth
 // @Tags         posts
 // @Produce      json
-// @Param        id   path  int  true  "Post ID"
-// @Success      200  {object}  map[string]any
-// @Failure      400  {object}  map[string]any "invalid id"
+// @Param        id               path   int  true   "Post ID"
+// @Param        likers_limit     query  int  false  "Likers page size (1-100, default 20)"
+// @Param        likers_offset    query  int  false  "Likers page offset"
+// @Param        comments_limit   query  int  false  "Comments page size (1-100, default 20)"
+// @Param        comments_offset  query  int  false  "Comments page offset"
+// @Success      200  {object}  model.PostDetail
+// @Failure      400  {object}  map[string]any "invalid id or query"
 // @Failure      401  {object}  map[string]any "missing or invalid token"
 // @Failure      404  {object}  map[string]any "post not found"
 // @Failure      500  {object}  map[string]any "internal server error"
 // @Router       /v1/posts/{id} [get]
 func (ct *PostController) Detail(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
 	}
-	data, err := ct.s.Detail(c.Request().Context(), id)
+	var q model.DetailQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query")
+	}
+	if err := c.Validate(&q); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "likers_limit and comments_limit must be 1-100, offsets >= 0")
+	}
+	data, err := ct.s.Detail(c.Request().Context(), id, uid, q)
 	if err != nil {
 		switch {
 		case errors.Is(err, postsvc.ErrNotFound):
 			return echo.NewHTTPError(http.StatusNotFound, "post not found")
 		default:
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			logger.From(c.Request().Context()).Error("post detail failed", "post_id", id, "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError)
 		}
 	}
 	return c.JSON(http.StatusOK, data)
 }
 
+// Comment on post
+// @Summary      Comment on post
+// @Description  Add a comment to a post (JWT required). It is listed under comments in the post detail.
+// @Security     BearerAuth
+// @Tags         posts
+// @Accept       json
+// @Produce      json
+// @Param        id       path  int                     true  "Post ID"
+// @Param        payload  body  model.CreateCommentReq  true  "Comment payload"
+// @Success      201  {object}  model.Comment
+// @Failure      400  {object}  map[string]any "invalid id / validation error"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "post not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/posts/{id}/comments [post]
+func (ct *PostController) AddComment(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	var req model.CreateCommentReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "content is required and at most 2200 characters")
+	}
+	cm, err := ct.s.AddComment(c.Request().Context(), id, uid, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, postsvc.ErrBadInput):
+			return echo.NewHTTPError(http.StatusBadRequest, postsvc.ErrBadInput.Error())
+		case errors.Is(err, postsvc.ErrNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "post not found")
+		default:
+			logger.From(c.Request().Context()).Error("add comment failed", "post_id", id, "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+	}
+	return c.JSON(http.StatusCreated, cm)
+}
+
 // Delete post
 // @Summary      Delete post
-// @Description  Delete a post by ID (JWT required; only owner can delete)
+// @Description  Soft-delete a post by ID (JWT required; only owner can delete). It can be restored until DELETE_RESTORE_WINDOW passes.
 // @Security     BearerAuth
 // @Tags         posts
 // @Produce      json
@@ -130,19 +187,10 @@ func (ct *PostController) Detail(c echo.Context) error {
 // @Failure      500  {object}  map[string]any "internal server error"
 // @Router       /v1/posts/{id} [delete]
 func (ct *PostController) Delete(c echo.Context) error {
-	tok, ok := c.Get("user").(*jwt.Token)
-	if !ok || tok == nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, "missing or invalid token")
-	}
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token claims")
-	}
-	sub, ok := claims["sub"].(float64)
-	if !ok {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid subject in token")
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
 	}
-	userID := int64(sub)
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -160,3 +208,47 @@ func (ct *PostController) Delete(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "deleted", "id": id})
 }
+
+// Restore post
+// @Summary      Restore post
+// @Description  Undo a delete within the restore window (JWT required; only owner can restore)
+// @Security     BearerAuth
+// @Tags         posts
+// @Produce      json
+// @Param        id   path  int  true  "Post ID"
+// @Success      200  {object}  model.Post
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "forbidden - not owner"
+// @Failure      404  {object}  map[string]any "post not found"
+// @Failure      409  {object}  map[string]any "post is not deleted"
+// @Failure      410  {object}  map[string]any "restore window has passed"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/posts/{id}/restore [post]
+func (ct *PostController) Restore(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	p, err := ct.s.Restore(c.Request().Context(), id, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, postsvc.ErrNotOwner):
+			return echo.NewHTTPError(http.StatusForbidden, "forbidden: not owner")
+		case errors.Is(err, postsvc.ErrNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "post not found")
+		case errors.Is(err, postsvc.ErrNotDeleted):
+			return echo.NewHTTPError(http.StatusConflict, postsvc.ErrNotDeleted.Error())
+		case errors.Is(err, postsvc.ErrRestoreExpired):
+			return echo.NewHTTPError(http.StatusGone, postsvc.ErrRestoreExpired.Error())
+		default:
+			logger.From(c.Request().Context()).Error("restore post failed", "post_id", id, "err", err)
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+	}
+	return c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,19 @@
+// app/echoServer/controller/principal.go
+package controller
+
+import (
+	"net/http"
+
+	"instagram/util/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// currentUserID is the caller, as authenticated by the auth middleware.
+func currentUserID(c echo.Context) (int64, error) {
+	p, ok := auth.From(c.Request().Context())
+	if !ok {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+	}
+	return p.UserID, nil
+}
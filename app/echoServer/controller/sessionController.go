@@ -0,0 +1,76 @@
+// app/echoServer/controller/sessionController.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	sessionsvc "instagram/service/session"
+	"instagram/util/auth"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SessionController struct{ s sessionsvc.Service }
+
+func NewSessionController(s sessionsvc.Service) *SessionController { return &SessionController{s} }
+
+// List sessions
+// @Summary      List login sessions
+// @Description  Devices currently signed in to the account, most recently used first. The one making this request has current set.
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Success      200  {array}   model.Session
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/sessions [get]
+func (ct *SessionController) List(c echo.Context) error {
+	p, ok := auth.From(c.Request().Context())
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+	}
+	ss, err := ct.s.List(c.Request().Context(), p.UserID, p.SessionID)
+	if err != nil {
+		logger.From(c.Request().Context()).Error("list sessions failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, ss)
+}
+
+// Revoke session
+// @Summary      Sign out a session
+// @Description  Ends the session; its token is rejected from the next request on. Revoking the current session signs this client out.
+// @Security     BearerAuth
+// @Tags         users
+// @Param        id   path  int  true  "Session ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      404  {object}  map[string]any "session not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/sessions/{id} [delete]
+func (ct *SessionController) Revoke(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	err = ct.s.Revoke(c.Request().Context(), id, uid)
+	switch {
+	case err == nil:
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, sessionsvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, sessionsvc.ErrNotFound.Error())
+	default:
+		logger.From(c.Request().Context()).Error("revoke session failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
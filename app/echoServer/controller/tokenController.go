@@ -0,0 +1,109 @@
+// app/echoServer/controller/tokenController.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"instagram/model"
+	tokensvc "instagram/service/token"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TokenController struct{ s tokensvc.Service }
+
+func NewTokenController(s tokensvc.Service) *TokenController { return &TokenController{s} }
+
+// Create access token
+// @Summary      Create personal access token
+// @Description  Issue a long-lived, scoped token for scripts. Send it as "Authorization: Bearer igp_...". The token is only shown in this response. Scopes: posts:read, posts:write, likes:write, activities:read.
+// @Security     BearerAuth
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  model.CreateAccessTokenReq  true  "Token"
+// @Success      201  {object}  model.AccessToken
+// @Failure      400  {object}  map[string]any "validation error"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/tokens [post]
+func (ct *TokenController) Create(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	var req model.CreateAccessTokenReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "validation error")
+	}
+	t, err := ct.s.Create(c.Request().Context(), uid, req)
+	if err != nil {
+		logger.From(c.Request().Context()).Error("create access token failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusCreated, t)
+}
+
+// List access tokens
+// @Summary      List personal access tokens
+// @Description  Includes revoked and expired tokens. Secrets are never returned.
+// @Security     BearerAuth
+// @Tags         users
+// @Produce      json
+// @Success      200  {array}   model.AccessToken
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/tokens [get]
+func (ct *TokenController) List(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	ts, err := ct.s.List(c.Request().Context(), uid)
+	if err != nil {
+		logger.From(c.Request().Context()).Error("list access tokens failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+	return c.JSON(http.StatusOK, ts)
+}
+
+// Revoke access token
+// @Summary      Revoke personal access token
+// @Security     BearerAuth
+// @Tags         users
+// @Param        id   path  int  true  "Token ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "not available to access tokens"
+// @Failure      404  {object}  map[string]any "access token not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/users/me/tokens/{id} [delete]
+func (ct *TokenController) Revoke(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	err = ct.s.Revoke(c.Request().Context(), id, uid)
+	switch {
+	case err == nil:
+		return c.NoContent(http.StatusNoContent)
+	case errors.Is(err, tokensvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, tokensvc.ErrNotFound.Error())
+	default:
+		logger.From(c.Request().Context()).Error("revoke access token failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
@@ -2,27 +2,24 @@
 package controller
 
 import (
+	"crypto/subtle"
 	"errors"
-	"log/slog"
 	"net/http"
 
 	"instagram/model"
 	authsvc "instagram/service/auth"
+	"instagram/util/logger"
 
 	"github.com/labstack/echo/v4"
 )
 
 type UserController struct {
-	s         authsvc.Service
-	jwtSecret string
-	log       *slog.Logger
+	s authsvc.Service
 }
 
-func NewUserController(s authsvc.Service, secret string, log *slog.Logger) *UserController {
+func NewUserController(s authsvc.Service) *UserController {
 	return &UserController{
-		s:         s,
-		jwtSecret: secret,
-		log:       log,
+		s: s,
 	}
 }
 
@@ -40,21 +37,22 @@ func NewUserController(s authsvc.Service, secret string, log *slog.Logger) *User
 // @Router       /v1/users/register [post]
 func (ct *UserController) Register(c echo.Context) error {
 	var req model.RegisterReq
+	log := logger.From(c.Request().Context())
 
 	// Bind
 	if err := c.Bind(&req); err != nil {
-		ct.log.Warn("bind failed", "path", c.Path(), "err", err)
+		log.Warn("bind failed", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
 	}
 
 	// Validate
 	if err := c.Validate(&req); err != nil {
-		ct.log.Warn("validation failed", "path", c.Path(), "err", err)
+		log.Warn("validation failed", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
 
 	// Business logic
-	u, _, err := ct.s.Register(c.Request().Context(), req, ct.jwtSecret)
+	u, err := ct.s.Register(c.Request().Context(), req)
 	if err != nil {
 		switch {
 		case errors.Is(err, authsvc.ErrEmailTaken):
@@ -65,17 +63,11 @@ func (ct *UserController) Register(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusConflict, "username already taken")
 		case errors.Is(err, authsvc.ErrBadInput):
 			// 400
-			ct.log.Warn("bad input", "path", c.Path(), "err", err)
+			log.Warn("bad input", "err", err)
 			return echo.NewHTTPError(http.StatusBadRequest)
 		default:
 			// Unknown → 500 (details only in logs)
-			rid := c.Response().Header().Get(echo.HeaderXRequestID)
-			ct.log.Error("register failed",
-				"err", err,
-				"req_id", rid,
-				"path", c.Path(),
-				"method", c.Request().Method,
-			)
+			log.Error("register failed", "err", err)
 			return echo.NewHTTPError(http.StatusInternalServerError, "register failed")
 		}
 	}
@@ -89,50 +81,229 @@ func (ct *UserController) Register(c echo.Context) error {
 
 // Login
 // @Summary      Login
-// @Description  Login with email + password, returns JWT
+// @Description  Login with email + password, returns JWT. For accounts with two-factor authentication the response has mfa_required and a challenge_token to redeem at /v1/users/login/2fa instead. A finished login also returns a device_id, set as a cookie too; send it back on later logins so the device is recognised, or the login is reported as coming from a new device.
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        payload  body  model.LoginReq  true  "Login payload"
-// @Success      200  {object}  map[string]any
+// @Param        payload      body    model.LoginReq  true   "Login payload"
+// @Param        X-Device-ID  header  string          false  "device_id from an earlier login"
+// @Success      200  {object}  model.LoginResult
 // @Failure      400  {object}  map[string]any
 // @Failure      401  {object}  map[string]any
 // @Failure      500  {object}  map[string]any
 // @Router       /v1/users/login [post]
 func (ct *UserController) Login(c echo.Context) error {
 	var req model.LoginReq
+	log := logger.From(c.Request().Context())
 
 	if err := c.Bind(&req); err != nil {
-		ct.log.Warn("bind failed", "path", c.Path(), "err", err)
+		log.Warn("bind failed", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
 	}
 	if err := c.Validate(&req); err != nil {
-		ct.log.Warn("validation failed", "path", c.Path(), "err", err)
+		log.Warn("validation failed", "err", err)
 		return echo.NewHTTPError(http.StatusBadRequest)
 	}
 
-	_, token, err := ct.s.Login(c.Request().Context(), req, ct.jwtSecret)
+	_, res, err := ct.s.Login(c.Request().Context(), req, client(c))
 	if err != nil {
 		switch {
 		case errors.Is(err, authsvc.ErrInvalidCreds):
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid email or password")
 		case errors.Is(err, authsvc.ErrBadInput):
-			ct.log.Warn("bad input", "path", c.Path(), "err", err)
+			log.Warn("bad input", "err", err)
 			return echo.NewHTTPError(http.StatusBadRequest)
 		default:
-			rid := c.Response().Header().Get(echo.HeaderXRequestID)
-			ct.log.Error("login failed",
-				"err", err,
-				"req_id", rid,
-				"path", c.Path(),
-				"method", c.Request().Method,
-			)
+			log.Error("login failed", "err", err)
 			return echo.NewHTTPError(http.StatusInternalServerError)
 		}
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"message": "login success",
-		"token":   token,
+	return c.JSON(http.StatusOK, loginResponse(c, res))
+}
+
+// Browsers send the device ID back in a cookie, other clients in a
+// header.
+const (
+	deviceCookie       = "device_id"
+	deviceHeader       = "X-Device-ID"
+	deviceCookieMaxAge = 400 * 24 * 60 * 60
+)
+
+// client describes the device a login comes from.
+func client(c echo.Context) model.Client {
+	cl := model.Client{
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+		DeviceID:  c.Request().Header.Get(deviceHeader),
+	}
+	if ck, err := c.Cookie(deviceCookie); cl.DeviceID == "" && err == nil {
+		cl.DeviceID = ck.Value
+	}
+	return cl
+}
+
+// loginResponse keeps the message and token fields clients already read,
+// and remembers the device of a finished login in a cookie.
+func loginResponse(c echo.Context, res *model.LoginResult) echo.Map {
+	if res.MFARequired {
+		return echo.Map{
+			"message":              "two-factor code required",
+			"mfa_required":         true,
+			"challenge_token":      res.ChallengeToken,
+			"challenge_expires_at": res.ChallengeExpiresAt,
+		}
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     deviceCookie,
+		Value:    res.DeviceID,
+		Path:     "/v1",
+		MaxAge:   deviceCookieMaxAge,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
+	return echo.Map{
+		"message":      "login success",
+		"mfa_required": false,
+		"token":        res.Token,
+		"device_id":    res.DeviceID,
+	}
+}
+
+// Second login step
+// @Summary      Login with a two-factor code
+// @Description  Redeems the challenge_token from login with a code from the authenticator app or an unused recovery code, and returns the JWT. Repeated wrong codes lock two-factor sign-in for a while.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        payload      body    model.MFALoginReq  true   "Challenge and code"
+// @Param        X-Device-ID  header  string             false  "device_id from an earlier login"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]any
+// @Failure      401  {object}  map[string]any "invalid code or expired challenge"
+// @Failure      429  {object}  map[string]any "too many wrong codes"
+// @Failure      500  {object}  map[string]any
+// @Router       /v1/users/login/2fa [post]
+func (ct *UserController) LoginMFA(c echo.Context) error {
+	var req model.MFALoginReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "validation error")
+	}
+
+	_, res, err := ct.s.LoginMFA(c.Request().Context(), req, client(c))
+	if err != nil {
+		if errors.Is(err, authsvc.ErrMFAChallenge) {
+			return echo.NewHTTPError(http.StatusUnauthorized, authsvc.ErrMFAChallenge.Error())
+		}
+		return mfaError(c, err)
+	}
+	return c.JSON(http.StatusOK, loginResponse(c, res))
+}
+
+// Sign in with the OpenID provider
+// @Summary      Start single sign-on
+// @Description  Redirects the browser to the configured OpenID Connect provider (authorization code flow with PKCE). The provider sends the browser back to the callback, which must happen in the same browser: the sign-in is tied to it by a short-lived cookie.
+// @Tags         users
+// @Success      302  "Redirect to the provider"
+// @Failure      404  {object}  map[string]any "single sign-on is not configured"
+// @Failure      429  {object}  map[string]any "too many sign-in attempts"
+// @Failure      502  {object}  map[string]any "provider unavailable"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/auth/oidc/login [get]
+func (ct *UserController) OIDCLogin(c echo.Context) error {
+	u, state, err := ct.s.OIDCStart(c.Request().Context())
+	if err != nil {
+		return oidcError(c, err)
+	}
+	setOIDCState(c, state, int(authsvc.OIDCStateTTL.Seconds()))
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Redirect(http.StatusFound, u)
+}
+
+// oidcStateCookie binds a single sign-on to the browser that started it,
+// so that a callback URL carrying someone else's code is refused.
+const oidcStateCookie = "oidc_state"
+
+// setOIDCState sets the state cookie, or deletes it when maxAge is < 0.
+func setOIDCState(c echo.Context, state string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/auth/oidc",
+		MaxAge:   maxAge,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		// Lax still sends it on the provider's top-level redirect back.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OpenID provider callback
+// @Summary      Finish single sign-on
+// @Description  Redeems the provider's code, links or creates the user and finishes like the password login, two-factor challenge included.
+// @Tags         users
+// @Produce      json
+// @Param        code   query  string  true  "Authorization code"
+// @Param        state  query  string  true  "State from the login redirect"
+// @Success      200  {object}  map[string]any
+// @Failure      400  {object}  map[string]any "sign-in expired or already completed"
+// @Failure      401  {object}  map[string]any "sign-in with the provider failed"
+// @Failure      404  {object}  map[string]any "single sign-on is not configured"
+// @Failure      409  {object}  map[string]any "email already registered"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/auth/oidc/callback [get]
+func (ct *UserController) OIDCCallback(c echo.Context) error {
+	if e := c.QueryParam("error"); e != "" {
+		logger.From(c.Request().Context()).Warn("provider denied sign-in", "error", e)
+		return echo.NewHTTPError(http.StatusUnauthorized, authsvc.ErrOIDCFailed.Error())
+	}
+	code, state := c.QueryParam("code"), c.QueryParam("state")
+	if code == "" || state == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing code or state")
+	}
+	bound, err := c.Cookie(oidcStateCookie)
+	setOIDCState(c, "", -1)
+	if err != nil || subtle.ConstantTimeCompare([]byte(bound.Value), []byte(state)) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, authsvc.ErrOIDCState.Error())
+	}
+	u, res, err := ct.s.OIDCCallback(c.Request().Context(), code, state, client(c))
+	if err != nil {
+		return oidcError(c, err)
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	body := loginResponse(c, res)
+	if !res.MFARequired {
+		body["user"] = u
+	}
+	return c.JSON(http.StatusOK, body)
+}
+
+// oidcError maps authsvc single sign-on errors to HTTP errors.
+func oidcError(c echo.Context, err error) error {
+	log := logger.From(c.Request().Context())
+	switch {
+	case errors.Is(err, authsvc.ErrOIDCDisabled):
+		return echo.NewHTTPError(http.StatusNotFound, authsvc.ErrOIDCDisabled.Error())
+	case errors.Is(err, authsvc.ErrOIDCState):
+		return echo.NewHTTPError(http.StatusBadRequest, authsvc.ErrOIDCState.Error())
+	case errors.Is(err, authsvc.ErrOIDCNoEmail):
+		return echo.NewHTTPError(http.StatusBadRequest, authsvc.ErrOIDCNoEmail.Error())
+	case errors.Is(err, authsvc.ErrEmailTaken):
+		return echo.NewHTTPError(http.StatusConflict, "email already registered; sign in with your password")
+	case errors.Is(err, authsvc.ErrUsernameTaken):
+		return echo.NewHTTPError(http.StatusConflict, authsvc.ErrUsernameTaken.Error())
+	case errors.Is(err, authsvc.ErrOIDCFailed):
+		log.Warn("oidc sign-in failed", "err", err)
+		if c.Request().URL.Path == "/v1/auth/oidc/login" {
+			return echo.NewHTTPError(http.StatusBadGateway, "provider unavailable")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, authsvc.ErrOIDCFailed.Error())
+	default:
+		log.Error("oidc sign-in failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
 }
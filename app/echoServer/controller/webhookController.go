@@ -0,0 +1,199 @@
+// app/echoServer/controller/webhookController.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"instagram/model"
+	webhooksvc "instagram/service/webhook"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+type WebhookController struct{ s webhooksvc.Service }
+
+func NewWebhookController(s webhooksvc.Service) *WebhookController { return &WebhookController{s} }
+
+// webhookError maps webhooksvc sentinels to HTTP errors.
+func webhookError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, webhooksvc.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, webhooksvc.ErrNotFound.Error())
+	case errors.Is(err, webhooksvc.ErrDeliveryNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, webhooksvc.ErrDeliveryNotFound.Error())
+	case errors.Is(err, webhooksvc.ErrGlobalForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, webhooksvc.ErrGlobalForbidden.Error())
+	case errors.Is(err, webhooksvc.ErrInsecureURL):
+		return echo.NewHTTPError(http.StatusBadRequest, webhooksvc.ErrInsecureURL.Error())
+	default:
+		logger.From(c.Request().Context()).Error("webhook request failed", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	}
+}
+
+// Create webhook
+// @Summary      Create webhook
+// @Description  Subscribe an https URL to events involving the caller: post.created, post.deleted, like.created, like.deleted. Deliveries are POSTed as JSON with an X-Webhook-Signature header "t=<unix>,v1=<hex HMAC-SHA256 of "<t>.<body>">" keyed by the secret, which is only returned here.
+// @Security     BearerAuth
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        payload  body  model.CreateWebhookReq  true  "Webhook"
+// @Success      201  {object}  model.Webhook
+// @Failure      400  {object}  map[string]any "validation error or non-https url"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      403  {object}  map[string]any "only admins can create global webhooks"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/webhooks [post]
+func (ct *WebhookController) Create(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	var req model.CreateWebhookReq
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "validation error")
+	}
+	w, err := ct.s.Create(c.Request().Context(), uid, req)
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusCreated, w)
+}
+
+// List my webhooks
+// @Summary      List my webhooks
+// @Security     BearerAuth
+// @Tags         webhooks
+// @Produce      json
+// @Success      200  {array}   model.Webhook
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/webhooks [get]
+func (ct *WebhookController) List(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	ws, err := ct.s.List(c.Request().Context(), uid)
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, ws)
+}
+
+// Delete webhook
+// @Summary      Delete webhook
+// @Description  Stops deliveries and drops the delivery log.
+// @Security     BearerAuth
+// @Tags         webhooks
+// @Param        id   path  int  true  "Webhook ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "webhook not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/webhooks/{id} [delete]
+func (ct *WebhookController) Delete(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	if err := ct.s.Delete(c.Request().Context(), id, uid); err != nil {
+		return webhookError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Webhook delivery log
+// @Summary      Webhook delivery log
+// @Description  Newest first; pass next_before_id back as before_id for the next page.
+// @Security     BearerAuth
+// @Tags         webhooks
+// @Produce      json
+// @Param        id         path   int  true   "Webhook ID"
+// @Param        before_id  query  int  false  "Only deliveries with a smaller ID"
+// @Param        limit      query  int  false  "Page size (1-100, default 50)"
+// @Success      200  {object}  model.DeliveryPage
+// @Failure      400  {object}  map[string]any "invalid id or query"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "webhook not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/webhooks/{id}/deliveries [get]
+func (ct *WebhookController) Deliveries(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	var beforeID int64
+	var limit int
+	if err := echo.QueryParamsBinder(c).
+		Int64("before_id", &beforeID).
+		Int("limit", &limit).
+		BindError(); err != nil {
+		var be *echo.BindingError
+		if errors.As(err, &be) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid "+be.Field)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid query")
+	}
+	if beforeID < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid before_id")
+	}
+	if limit < 0 || limit > 100 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+	}
+	page, err := ct.s.Deliveries(c.Request().Context(), id, uid, beforeID, limit)
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// Replay webhook delivery
+// @Summary      Replay webhook delivery
+// @Description  Sends a past delivery's payload again as a new delivery. The body, and so the event id, is unchanged.
+// @Security     BearerAuth
+// @Tags         webhooks
+// @Produce      json
+// @Param        id          path  int  true  "Webhook ID"
+// @Param        deliveryID  path  int  true  "Delivery ID"
+// @Success      202  {object}  model.WebhookDelivery
+// @Failure      400  {object}  map[string]any "invalid id"
+// @Failure      401  {object}  map[string]any "missing or invalid token"
+// @Failure      404  {object}  map[string]any "webhook or delivery not found"
+// @Failure      500  {object}  map[string]any "internal server error"
+// @Router       /v1/webhooks/{id}/deliveries/{deliveryID}/replay [post]
+func (ct *WebhookController) Replay(c echo.Context) error {
+	uid, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid delivery id")
+	}
+	d, err := ct.s.Replay(c.Request().Context(), id, deliveryID, uid)
+	if err != nil {
+		return webhookError(c, err)
+	}
+	return c.JSON(http.StatusAccepted, d)
+}
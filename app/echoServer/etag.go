@@ -0,0 +1,82 @@
+// app/echoServer/etag.go
+package echoServer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ETag tags 200 responses to GET and HEAD with a hash of the body and
+// answers a matching If-None-Match with 304 Not Modified. The response is
+// buffered, so keep it off streaming endpoints.
+func ETag() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+			orig := res.Writer
+			buf := &bufferWriter{ResponseWriter: orig, status: http.StatusOK}
+			res.Writer = buf
+			defer func() { res.Writer = orig }()
+
+			if err := next(c); err != nil {
+				// Render into the buffer so the error goes out below.
+				c.Error(err)
+			}
+
+			if buf.status != http.StatusOK {
+				orig.WriteHeader(buf.status)
+				_, err := orig.Write(buf.body.Bytes())
+				return err
+			}
+
+			sum := sha256.Sum256(buf.body.Bytes())
+			tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			h := res.Header()
+			h.Set("ETag", tag)
+			if etagMatch(req.Header.Get("If-None-Match"), tag) {
+				h.Del(echo.HeaderContentType)
+				h.Del(echo.HeaderContentLength)
+				res.Status = http.StatusNotModified
+				orig.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+			orig.WriteHeader(http.StatusOK)
+			_, err := orig.Write(buf.body.Bytes())
+			return err
+		}
+	}
+}
+
+// etagMatch applies the weak comparison If-None-Match calls for.
+func etagMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type bufferWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(status int) { w.status = status }
+
+func (w *bufferWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
@@ -0,0 +1,116 @@
+// app/echoServer/idempotency.go
+package echoServer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	idempotencysvc "instagram/service/idempotency"
+	"instagram/util/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotencyReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// Idempotency replays the stored response when an authenticated client
+// retries a request with the same Idempotency-Key. A duplicate arriving
+// while the first is still running gets 409. Requests without the header
+// pass through untouched. Mount it after Authenticate.
+func Idempotency(s idempotencysvc.Service) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := strings.TrimSpace(c.Request().Header.Get(HeaderIdempotencyKey))
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			}
+			p, ok := principal(c)
+			if !ok {
+				return next(c)
+			}
+
+			req := c.Request()
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			ctx := req.Context()
+
+			rec, err := s.Begin(ctx, p.UserID, key, fingerprint(req, body))
+			switch {
+			case errors.Is(err, idempotencysvc.ErrInFlight):
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			case errors.Is(err, idempotencysvc.ErrKeyReused):
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+			case err != nil:
+				return err
+			case rec.Completed():
+				c.Response().Header().Set(HeaderIdempotencyReplayed, "true")
+				return c.Blob(rec.StatusCode, rec.ContentType, rec.Body)
+			}
+
+			res := c.Response()
+			orig := res.Writer
+			tee := &teeWriter{ResponseWriter: orig}
+			res.Writer = tee
+
+			// The key must not stay reserved when the handler panics,
+			// otherwise every retry would get 409 until it goes stale.
+			finished := false
+			defer func() {
+				res.Writer = orig
+				if !finished {
+					_ = s.Finish(context.WithoutCancel(ctx), rec, http.StatusInternalServerError, "", nil)
+				}
+			}()
+
+			if err := next(c); err != nil {
+				// Render now so the stored body is exactly what the client got.
+				c.Error(err)
+			}
+
+			finished = true
+			if err := s.Finish(context.WithoutCancel(ctx), rec, res.Status, res.Header().Get(echo.HeaderContentType), tee.buf.Bytes()); err != nil {
+				logger.From(ctx).Error("store idempotent response failed", "err", err)
+			}
+			return nil
+		}
+	}
+}
+
+// fingerprint ties a key to one request so it can't be replayed for a
+// different payload or endpoint.
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, req.URL.Path)
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type teeWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -2,14 +2,30 @@
 package echoServer
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
 	"time"
 
-	"instagram/util/jwt"
+	"instagram/util/loader"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 func RegisterMiddlewares(e *echo.Echo) {
@@ -20,43 +36,180 @@ func RegisterMiddlewares(e *echo.Echo) {
 		Generator: func() string { return uuid.NewString() },
 	}))
 
+	e.Use(Tracing())
 	e.Use(Slog())
+	e.Use(Metrics())
+	e.Use(Loaders())
 }
 
+// IPExtractor takes the client IP from X-Forwarded-For, skipping only
+// hops appended by proxies on loopback, private or link-local addresses
+// or in trusted (CIDRs), so a client can't pick its own address by
+// sending the header.
+func IPExtractor(trusted []string) (echo.IPExtractor, error) {
+	opts := make([]echo.TrustOption, 0, len(trusted))
+	for _, cidr := range trusted {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		opts = append(opts, echo.TrustIPRange(n))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+// RateLimit lets each client IP make perMinute requests a minute, in
+// bursts of up to perMinute, on this instance.
+func RateLimit(perMinute int) echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(float64(perMinute) / 60),
+			Burst:     perMinute,
+			ExpiresIn: 3 * time.Minute,
+		}),
+	})
+}
+
+// Loaders opens a request-scoped batch loader cache, so related rows
+// looked up more than once while serving a request are fetched once.
+func Loaders() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			c.SetRequest(req.WithContext(loader.WithScope(req.Context())))
+			return next(c)
+		}
+	}
+}
+
+// Slog stores a request-scoped logger (request ID, route, method, trace)
+// in the request context for logger.From, then logs the access line.
 func Slog() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			start := time.Now()
+			req := c.Request()
+
+			l := slog.Default().With(
+				"req_id", c.Response().Header().Get(echo.HeaderXRequestID),
+				"method", req.Method,
+				"path", c.Path(),
+			)
+			if tid := tracing.TraceID(req.Context()); tid != "" {
+				l = l.With("trace_id", tid)
+			}
+			c.SetRequest(req.WithContext(logger.With(req.Context(), l)))
+
 			err := next(c)
 			lat := time.Since(start).Milliseconds()
 
-			rid := c.Response().Header().Get(echo.HeaderXRequestID)
-			slog.Info("http",
-				"method", c.Request().Method,
-				"path", c.Path(),
-				"status", c.Response().Status,
+			// Re-read the context: auth middleware may have added user_id.
+			logger.From(c.Request().Context()).Info("http",
+				"status", responseStatus(c, err),
 				"latency_ms", lat,
-				"req_id", rid,
 				"ip", c.RealIP(),
-				"ua", c.Request().UserAgent(),
+				"ua", req.UserAgent(),
 			)
 			return err
 		}
 	}
 }
 
-func JWTAuth(secret string) echo.MiddlewareFunc {
+// Tracing continues the caller's W3C trace (or starts one) and wraps the
+// request in a server span named after the route template.
+func Tracing() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			claims, err := jwt.ParseAuth(c.Request().Header.Get("Authorization"), secret)
-			if err != nil {
-				return echo.NewHTTPError(401, "unauthenticated")
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			ctx, span := tracing.Tracer().Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+					semconv.UserAgentOriginal(req.UserAgent()),
+					attribute.String("http.request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				tracing.Fail(span, err)
+				if err == nil {
+					span.SetStatus(codes.Error, http.StatusText(status))
+				}
 			}
-			idf, ok := claims["sub"].(float64)
+			return err
+		}
+	}
+}
+
+// Metrics records request counts and latency per route template, so
+// /posts/1 and /posts/2 share one series.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(responseStatus(c, err))
+			method := c.Request().Method
+
+			metrics.HTTPRequests.WithLabelValues(route, method, status).Inc()
+			metrics.HTTPDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// responseStatus is the status the client will see. A returned error is
+// only turned into a response by the HTTP error handler after the
+// middleware chain unwinds, so it has to be derived from err here.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// RequireRole lets through only users whose current role, per lookup, is
+// role. Mount it after Authenticate. The role claim in the token is
+// ignored: it is only as fresh as the token.
+func RequireRole(lookup func(ctx context.Context, userID int64) (string, error), role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := principal(c)
 			if !ok {
-				return echo.NewHTTPError(401, "unauthenticated")
+				return echo.NewHTTPError(http.StatusUnauthorized, "unauthenticated")
+			}
+			got, err := lookup(c.Request().Context(), p.UserID)
+			if err != nil {
+				logger.From(c.Request().Context()).Error("role lookup failed", "err", err)
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+			if got != role {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden")
 			}
-			c.Set("uid", int64(idf))
 			return next(c)
 		}
 	}
@@ -2,9 +2,9 @@ package echoServer
 
 import (
 	"instagram/app/echoServer/controller"
+	"instagram/model"
+	"instagram/util/metrics"
 
-	"github.com/golang-jwt/jwt/v5"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
@@ -13,43 +13,112 @@ type C struct {
 	Post     *controller.PostController
 	Like     *controller.LikeController
 	Activity *controller.ActivityController
+	Health   *controller.HealthController
+	Export   *controller.ExportController
+	Job      *controller.JobController
+	Webhook  *controller.WebhookController
+	Token    *controller.TokenController
+	Key      *controller.KeyController
+	MFA      *controller.MFAController
+	Session  *controller.SessionController
 
-	JWTSecret string
+	// Idempotency wraps POST routes that mobile clients retry.
+	Idempotency echo.MiddlewareFunc
+	// Admin restricts a route group to administrators.
+	Admin echo.MiddlewareFunc
+	// Auth authenticates the caller; see Authenticate.
+	Auth echo.MiddlewareFunc
+	// SignInLimit throttles unauthenticated sign-in starts, which each
+	// store state.
+	SignInLimit echo.MiddlewareFunc
+}
+
+// tokenScopes lists the routes personal access tokens may call, keyed by
+// method and route template, and the scope each needs. Routes not listed
+// need a login.
+var tokenScopes = map[string]string{
+	"GET /v1/posts":               model.ScopePostsRead,
+	"GET /v1/posts/:id":           model.ScopePostsRead,
+	"POST /v1/posts":              model.ScopePostsWrite,
+	"DELETE /v1/posts/:id":        model.ScopePostsWrite,
+	"POST /v1/posts/:id/restore":  model.ScopePostsWrite,
+	"POST /v1/posts/:id/comments": model.ScopePostsWrite,
+	"POST /v1/likes":              model.ScopeLikesWrite,
+	"DELETE /v1/likes/:id":        model.ScopeLikesWrite,
+	"PUT /v1/posts/:id/like":      model.ScopeLikesWrite,
+	"DELETE /v1/posts/:id/like":   model.ScopeLikesWrite,
+	"GET /v1/activities":          model.ScopeActivitiesRead,
+	"GET /v1/activities/export":   model.ScopeActivitiesRead,
 }
 
 func Register(e *echo.Echo, c C) {
+	// Probes
+	e.GET("/livez", c.Health.Livez)
+	e.GET("/readyz", c.Health.Readyz)
+	// Kept for existing monitors; same semantics as /readyz.
+	e.GET("/health", c.Health.Readyz)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	e.GET("/.well-known/jwks.json", c.Key.JWKS)
+
 	// Public group
 	pub := e.Group("/v1")
 	pub.POST("/users/register", c.User.Register)
 	pub.POST("/users/login", c.User.Login)
+	pub.POST("/users/login/2fa", c.User.LoginMFA)
+	pub.GET("/auth/oidc/login", c.User.OIDCLogin, c.SignInLimit)
+	pub.GET("/auth/oidc/callback", c.User.OIDCCallback)
+	// Authorized by the link signature rather than a bearer token.
+	pub.GET("/exports/:id/download", c.Export.Download)
 
-	// Protected group (JWT required)
+	// Protected group (login or access token required)
 	auth := e.Group("/v1")
 
-	auth.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey:  []byte(c.JWTSecret),
-		TokenLookup: "header:Authorization",
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return jwt.MapClaims{}
-		},
-		ErrorHandler: func(ctx echo.Context, err error) error {
-			hdr := ctx.Request().Header.Get("Authorization")
-			return ctx.JSON(401, echo.Map{
-				"message": "invalid or missing token",
-				"error":   err.Error(),
-				"got":     hdr,
-			})
-		},
-	}))
+	auth.Use(c.Auth)
+
+	// Conditional GETs: clients revalidate with If-None-Match.
+	etag := ETag()
 
 	// Routes under auth
-	auth.POST("/posts", c.Post.Create)
-	auth.GET("/posts", c.Post.List)
-	auth.GET("/posts/:id", c.Post.Detail)
+	auth.POST("/posts", c.Post.Create, c.Idempotency)
+	auth.GET("/posts", c.Post.List, etag)
+	auth.GET("/posts/:id", c.Post.Detail, etag)
 	auth.DELETE("/posts/:id", c.Post.Delete)
+	auth.POST("/posts/:id/restore", c.Post.Restore)
+	auth.POST("/posts/:id/comments", c.Post.AddComment, c.Idempotency)
 
-	auth.POST("/likes", c.Like.Create)
+	auth.POST("/likes", c.Like.Create, c.Idempotency)
 	auth.DELETE("/likes/:id", c.Like.Delete)
+	auth.PUT("/posts/:id/like", c.Like.Like)
+	auth.DELETE("/posts/:id/like", c.Like.Unlike)
+
+	auth.GET("/activities", c.Activity.ListMine, etag)
+	// Streams; must stay off the buffering ETag middleware.
+	auth.GET("/activities/export", c.Activity.Export)
+
+	auth.POST("/users/me/export", c.Export.Request)
+	auth.GET("/users/me/export/:id", c.Export.Status)
+
+	auth.POST("/webhooks", c.Webhook.Create)
+	auth.GET("/webhooks", c.Webhook.List)
+	auth.DELETE("/webhooks/:id", c.Webhook.Delete)
+	auth.GET("/webhooks/:id/deliveries", c.Webhook.Deliveries)
+	auth.POST("/webhooks/:id/deliveries/:deliveryID/replay", c.Webhook.Replay)
+
+	auth.POST("/users/me/tokens", c.Token.Create)
+	auth.GET("/users/me/tokens", c.Token.List)
+	auth.DELETE("/users/me/tokens/:id", c.Token.Revoke)
+
+	auth.GET("/users/me/2fa", c.MFA.Status)
+	auth.POST("/users/me/2fa", c.MFA.Enroll)
+	auth.POST("/users/me/2fa/confirm", c.MFA.Confirm)
+	auth.POST("/users/me/2fa/disable", c.MFA.Disable)
+	auth.POST("/users/me/2fa/recovery-codes", c.MFA.RegenerateRecoveryCodes)
+
+	auth.GET("/users/me/sessions", c.Session.List)
+	auth.DELETE("/users/me/sessions/:id", c.Session.Revoke)
 
-	auth.GET("/activities", c.Activity.ListMine)
+	admin := auth.Group("/admin", c.Admin)
+	admin.GET("/jobs", c.Job.List)
+	admin.GET("/jobs/:id", c.Job.Detail)
+	admin.POST("/jobs/:id/retry", c.Job.Retry)
 }
@@ -1,9 +1,151 @@
 package config
 
+import "time"
+
+// App is the effective application configuration.
+//
+// Every leaf field is described by struct tags read by Load:
+//
+//	env      environment variable name; ",required" rejects empty values
+//	default  value used when neither the config file nor the env sets it
+//	redact   "true" hides the value in dumps, "url" only hides URL passwords
+//	validate go-playground/validator rules checked after loading
+//
+// Config file keys are the lower-cased env names (APP_PORT -> app_port).
 type App struct {
 	Port         string `env:"APP_PORT" default:"8080"`
-	DatabaseURL  string `env:"DATABASE_URL,required"`
-	JWTSecret    string `env:"JWT_SECRET,required"`
-	ApiNinjasKey string `env:"API_NINJAS_KEY"`
-	Env          string `env:"APP_ENV" default:"dev"`
+	DatabaseURL  string `env:"DATABASE_URL,required" redact:"url"`
+	JWTSecret    string `env:"JWT_SECRET,required" redact:"true"`
+	ApiNinjasKey string `env:"API_NINJAS_KEY" redact:"true"`
+	Env          string `env:"APP_ENV" default:"dev" validate:"oneof=dev test staging prod"`
+
+	// JokeProvider selects where post jokes come from: "api" (API-Ninjas)
+	// or "offline" (JokeFile, or the built-in list when it is empty).
+	JokeProvider string `env:"JOKE_PROVIDER" default:"api" validate:"oneof=api offline"`
+	JokeAPIURL   string `env:"JOKE_API_URL" default:"https://api.api-ninjas.com" validate:"url"`
+	JokeFile     string `env:"JOKE_FILE"`
+
+	DB DB
+
+	// HealthUpstreamTTL caches the joke upstream probe in /readyz so that
+	// frequent probes don't hammer the provider.
+	HealthUpstreamTTL time.Duration `env:"HEALTH_UPSTREAM_TTL" default:"1m"`
+
+	// ShutdownTimeout bounds how long in-flight requests may drain after
+	// SIGTERM. Heroku sends SIGKILL 30s after SIGTERM, so stay below that.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"20s"`
+
+	// IdempotencyTTL is how long a stored POST response can be replayed.
+	// IdempotencyStaleAfter frees keys whose first request never finished.
+	IdempotencyTTL        time.Duration `env:"IDEMPOTENCY_TTL" default:"24h"`
+	IdempotencyStaleAfter time.Duration `env:"IDEMPOTENCY_STALE_AFTER" default:"2m"`
+
+	// LikeReconcileInterval is how often posts.like_count is checked
+	// against the likes table.
+	LikeReconcileInterval time.Duration `env:"LIKE_RECONCILE_INTERVAL" default:"1h" validate:"gt=0"`
+
+	// Deleted posts can be restored for DeleteRestoreWindow; deleted posts
+	// and likes are purged for good after DeleteRetention.
+	DeleteRestoreWindow time.Duration `env:"DELETE_RESTORE_WINDOW" default:"72h" validate:"gte=0"`
+	DeleteRetention     time.Duration `env:"DELETE_RETENTION" default:"720h" validate:"gtefield=DeleteRestoreWindow"`
+
+	// Takeout archives are written to ExportDir and kept for
+	// ExportRetention. Download links are valid for ExportLinkTTL and
+	// signed with ExportURLSecret, or JWT_SECRET when it is empty outside
+	// prod.
+	ExportDir       string        `env:"EXPORT_DIR" default:"exports"`
+	ExportRetention time.Duration `env:"EXPORT_RETENTION" default:"168h" validate:"gt=0"`
+	ExportLinkTTL   time.Duration `env:"EXPORT_LINK_TTL" default:"15m" validate:"gt=0"`
+	ExportURLSecret string        `env:"EXPORT_URL_SECRET" redact:"true"`
+
+	// Background jobs run JobConcurrency at a time per instance. An attempt
+	// may hold a job for JobLockTimeout before it is presumed crashed and
+	// run again; failures are retried up to JobMaxAttempts times, then
+	// dead-lettered. Finished jobs are kept for JobRetention.
+	JobConcurrency  int           `env:"JOB_CONCURRENCY" default:"4" validate:"gte=1"`
+	JobPollInterval time.Duration `env:"JOB_POLL_INTERVAL" default:"1s" validate:"gt=0"`
+	JobLockTimeout  time.Duration `env:"JOB_LOCK_TIMEOUT" default:"15m" validate:"gt=0"`
+	JobMaxAttempts  int           `env:"JOB_MAX_ATTEMPTS" default:"5" validate:"gte=1"`
+	JobRetention    time.Duration `env:"JOB_RETENTION" default:"168h" validate:"gt=0"`
+
+	// Webhook deliveries are tried WebhookMaxAttempts times with the job
+	// queue's backoff and kept for WebhookRetention once settled. Targets
+	// on private networks are refused unless WebhookAllowPrivate is set,
+	// e.g. for local development. Plain http targets are only allowed in
+	// dev.
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"8" validate:"gte=1"`
+	WebhookAllowPrivate bool          `env:"WEBHOOK_ALLOW_PRIVATE" default:"false"`
+	WebhookRetention    time.Duration `env:"WEBHOOK_RETENTION" default:"720h" validate:"gt=0"`
+
+	// Login tokens are signed with JWTAlg, valid for JWTTTL and name
+	// JWTIssuer and JWTAudience, which verification requires. For RS256
+	// and EdDSA the keys live in the database, sealed with JWTKeySecret
+	// (JWT_SECRET when empty, outside prod), and a new one takes over
+	// every JWTKeyRotation; HS256 signs with JWT_SECRET and is refused in
+	// prod. Changing JWTAlg from HS256, or issuer or audience, signs
+	// everyone out.
+	JWTAlg         string        `env:"JWT_ALG" default:"RS256" validate:"oneof=HS256 RS256 EdDSA"`
+	JWTTTL         time.Duration `env:"JWT_TTL" default:"24h" validate:"gt=0"`
+	JWTIssuer      string        `env:"JWT_ISSUER" default:"instagram" validate:"required"`
+	JWTAudience    string        `env:"JWT_AUDIENCE" default:"instagram-api" validate:"required"`
+	JWTKeyRotation time.Duration `env:"JWT_KEY_ROTATION" default:"720h" validate:"gte=2h"`
+	JWTKeySecret   string        `env:"JWT_KEY_SECRET" redact:"true"`
+
+	// Two-factor authentication. MFAIssuer names the account in
+	// authenticator apps. Seeds are sealed with MFASecret, or JWT_SECRET
+	// when it is empty outside prod.
+	MFAIssuer string `env:"MFA_ISSUER" default:"Instagram Mini" validate:"required"`
+	MFASecret string `env:"MFA_SECRET" redact:"true"`
+
+	// Single sign-on with an OpenID Connect provider, off while OIDCIssuer
+	// is empty. OIDCRedirectURL must point at /v1/auth/oidc/callback and be
+	// registered with the provider. OIDCStartRate caps sign-in starts per
+	// client IP and minute.
+	OIDCIssuer       string `env:"OIDC_ISSUER" validate:"omitempty,url"`
+	OIDCClientID     string `env:"OIDC_CLIENT_ID" validate:"required_with=OIDCIssuer"`
+	OIDCClientSecret string `env:"OIDC_CLIENT_SECRET" redact:"true"`
+	OIDCRedirectURL  string `env:"OIDC_REDIRECT_URL" validate:"required_with=OIDCIssuer,omitempty,url"`
+	OIDCScopes       string `env:"OIDC_SCOPES" default:"openid email profile"`
+	OIDCStartRate    int    `env:"OIDC_START_RATE" default:"10" validate:"gte=1"`
+
+	// Client IPs, as logged, rate-limited and shown on sessions, are read
+	// from X-Forwarded-For only when appended by proxies on loopback,
+	// private or link-local addresses or in TrustedProxies
+	// (space-separated CIDRs).
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+
+	// CacheSize bounds each in-memory read cache (posts, users) by entry
+	// count. CacheTTL caps staleness for writes made by other instances;
+	// 0 disables the caches.
+	CacheSize int           `env:"CACHE_SIZE" default:"10000" validate:"gte=1"`
+	CacheTTL  time.Duration `env:"CACHE_TTL" default:"30s" validate:"gte=0"`
+
+	LogLevel  string `env:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	LogFormat string `env:"LOG_FORMAT" default:"json" validate:"oneof=json text"`
+
+	Tracing Tracing
 }
+
+// Tracing configures OpenTelemetry export. "stdout" and "file" write
+// JSON spans locally and need no collector.
+type Tracing struct {
+	ServiceName  string  `env:"OTEL_SERVICE_NAME" default:"instagram"`
+	Exporter     string  `env:"TRACING_EXPORTER" default:"none" validate:"oneof=none stdout file otlp"`
+	File         string  `env:"TRACING_FILE" default:"traces.jsonl"`
+	OTLPEndpoint string  `env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	SampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" default:"1" validate:"gte=0,lte=1"`
+}
+
+// DB tunes the Postgres pool and the startup connectivity check.
+type DB struct {
+	MaxConns          int32         `env:"DB_MAX_CONNS" default:"10" validate:"gte=1"`
+	MinConns          int32         `env:"DB_MIN_CONNS" default:"0" validate:"gte=0,ltefield=MaxConns"`
+	MaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME" default:"1h"`
+	MaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME" default:"30m"`
+	HealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD" default:"1m"`
+	StatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT" default:"30s"`
+	ConnectRetries    int           `env:"DB_CONNECT_RETRIES" default:"5" validate:"gte=0"`
+	ConnectBackoff    time.Duration `env:"DB_CONNECT_BACKOFF" default:"500ms"`
+}
+
+func (a App) IsProd() bool { return a.Env == "prod" }
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redacted = "********"
+
+// Dump renders the effective configuration as KEY=value lines with secrets
+// masked, suitable for printing at startup.
+func (a App) Dump() string {
+	var b strings.Builder
+	for _, kv := range a.entries() {
+		fmt.Fprintf(&b, "%s=%s\n", kv[0], kv[1])
+	}
+	return b.String()
+}
+
+// LogValue makes App safe to pass to slog directly.
+func (a App) LogValue() slog.Value {
+	entries := a.entries()
+	attrs := make([]slog.Attr, len(entries))
+	for i, kv := range entries {
+		attrs[i] = slog.String(kv[0], kv[1])
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (a App) entries() [][2]string {
+	var out [][2]string
+	walk(reflect.ValueOf(&a).Elem(), func(f reflect.StructField, v reflect.Value) {
+		key, _ := envTag(f)
+		out = append(out, [2]string{key, redact(f.Tag.Get("redact"), format(v))})
+	})
+	return out
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func redact(mode, s string) string {
+	if s == "" {
+		return s
+	}
+	switch mode {
+	case "true":
+		return redacted
+	case "url":
+		// Keyword/value DSNs ("host=db password=...") parse as a bare
+		// path; only a real URL can be masked in part.
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return redacted
+		}
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.Redacted()
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"postgres://app:hunter2@db:5432/insta?sslmode=require", "postgres://app:xxxxx@db:5432/insta?sslmode=require"},
+		{"postgres://app@db/insta?password=hunter2", "postgres://app@db/insta?password=xxxxx"},
+		{"host=localhost user=app password=hunter2 dbname=insta", redacted},
+		{"postgres:///insta?host=/run/postgresql&password=hunter2", redacted},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := redact("url", tt.in)
+		if strings.Contains(got, "hunter2") {
+			t.Errorf("redact(%q) = %q leaks the password", tt.in, got)
+		}
+		if got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDumpMasksKeywordDSN(t *testing.T) {
+	a := App{DatabaseURL: "host=localhost user=app password=hunter2 dbname=insta", JWTSecret: "s3cret"}
+	out := a.Dump()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "s3cret") {
+		t.Errorf("Dump leaks a secret:\n%s", out)
+	}
+}
@@ -1,33 +1,247 @@
 package config
 
 import (
-	"log/slog"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
 )
 
-func Load() App {
-	cfg := App{
-		Port:         getenv("APP_PORT", "8080"),
-		DatabaseURL:  must("DATABASE_URL"),
-		JWTSecret:    getenv("JWT_SECRET", "local_dev_secret"),
-		ApiNinjasKey: os.Getenv("API_NINJAS_KEY"),
-		Env:          getenv("APP_ENV", "dev"),
+// FileEnv names the env variable pointing at an optional YAML/JSON config
+// file. Values from the file sit between struct defaults and the env.
+const FileEnv = "CONFIG_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds App from struct defaults, the CONFIG_FILE file (if any) and
+// the environment, in increasing order of precedence, then validates it.
+func Load() (App, error) {
+	var cfg App
+
+	file, err := readFile(os.Getenv(FileEnv))
+	if err != nil {
+		return cfg, err
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(&cfg).Elem(), func(f reflect.StructField, v reflect.Value) {
+		if err := populate(f, v, file); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func readFile(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	// YAML is a superset of JSON, so one decoder covers both formats.
+	var raw map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	out := make(map[string]any, len(raw))
+	for k, v := range raw {
+		out[strings.ToLower(k)] = v
+	}
+	return out, nil
+}
+
+// walk calls fn for every leaf field carrying an env tag, descending into
+// nested structs so related settings can be grouped.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			walk(fv, fn)
+			continue
+		}
+		if _, ok := f.Tag.Lookup("env"); ok {
+			fn(f, fv)
+		}
+	}
+}
+
+func envTag(f reflect.StructField) (name string, required bool) {
+	parts := strings.Split(f.Tag.Get("env"), ",")
+	for _, opt := range parts[1:] {
+		if strings.TrimSpace(opt) == "required" {
+			required = true
+		}
+	}
+	return parts[0], required
+}
+
+func populate(f reflect.StructField, v reflect.Value, file map[string]any) error {
+	key, required := envTag(f)
+
+	raw, ok := os.LookupEnv(key)
+	if !ok || raw == "" {
+		raw, ok = fileValue(file, strings.ToLower(key))
+	}
+	if !ok || raw == "" {
+		raw, ok = f.Tag.Lookup("default")
+	}
+	if !ok || raw == "" {
+		if required {
+			return fmt.Errorf("%s is required", key)
+		}
+		return nil
+	}
+
+	if err := set(v, raw); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
 	}
-	return cfg
+	return nil
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+func fileValue(file map[string]any, key string) (string, bool) {
+	v, ok := file[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	if list, ok := v.([]any); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ","), true
 	}
-	return def
+	return fmt.Sprint(v), true
 }
 
-func must(k string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		slog.Error("required env missing", "key", k)
-		panic("missing env " + k)
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", v.Type())
+		}
+		var out []string
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		v.Set(reflect.ValueOf(out))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// Validate runs the validate tags and, in prod, refuses settings that are
+// only acceptable on a developer machine.
+func (a App) Validate() error {
+	if err := validator.New().Struct(a); err != nil {
+		var verrs validator.ValidationErrors
+		if errors.As(err, &verrs) {
+			errs := make([]error, 0, len(verrs))
+			for _, fe := range verrs {
+				errs = append(errs, fmt.Errorf("%s: failed %q (%s)", fe.StructNamespace(), fe.Tag(), fe.Param()))
+			}
+			return errors.Join(errs...)
+		}
+		return err
+	}
+
+	if a.IsProd() {
+		return a.checkProd()
+	}
+	return nil
+}
+
+var insecureSecrets = []string{"local_dev_secret", "secret", "changeme", "dev"}
+
+func (a App) checkProd() error {
+	var errs []error
+	for _, s := range insecureSecrets {
+		if strings.EqualFold(a.JWTSecret, s) {
+			errs = append(errs, errors.New("JWT_SECRET uses a known development value"))
+			break
+		}
+	}
+	if len(a.JWTSecret) < 32 {
+		errs = append(errs, errors.New("JWT_SECRET must be at least 32 characters in prod"))
+	}
+	// Each secret guards something else; one leaked value must not
+	// unlock the rest.
+	for _, s := range []struct{ name, value string }{
+		{"JWT_KEY_SECRET", a.JWTKeySecret},
+		{"MFA_SECRET", a.MFASecret},
+		{"EXPORT_URL_SECRET", a.ExportURLSecret},
+	} {
+		switch {
+		case len(s.value) < 32:
+			errs = append(errs, fmt.Errorf("%s must be set to at least 32 characters in prod", s.name))
+		case s.value == a.JWTSecret:
+			errs = append(errs, fmt.Errorf("%s must differ from JWT_SECRET", s.name))
+		}
+	}
+	if a.JWTAlg == "HS256" {
+		errs = append(errs, errors.New("JWT_ALG=HS256 is not allowed in prod; use RS256 or EdDSA"))
+	}
+	if strings.Contains(a.DatabaseURL, "sslmode=disable") {
+		errs = append(errs, errors.New("DATABASE_URL must not disable TLS in prod"))
 	}
-	return v
+	return errors.Join(errs...)
 }
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckProdExportURLSecret(t *testing.T) {
+	jwt := strings.Repeat("j", 32)
+	base := App{
+		JWTSecret:    jwt,
+		JWTAlg:       "RS256",
+		JWTKeySecret: strings.Repeat("k", 32),
+		MFASecret:    strings.Repeat("m", 32),
+		DatabaseURL:  "postgres://app@db/insta?sslmode=require",
+	}
+	tests := []struct {
+		secret  string
+		wantErr string
+	}{
+		{strings.Repeat("e", 32), ""},
+		{"", "EXPORT_URL_SECRET must be set"},
+		{"short", "EXPORT_URL_SECRET must be set"},
+		{jwt, "EXPORT_URL_SECRET must differ from JWT_SECRET"},
+	}
+	for _, tt := range tests {
+		a := base
+		a.ExportURLSecret = tt.secret
+		err := a.checkProd()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("checkProd(%q) = %v, want nil", tt.secret, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("checkProd(%q) = %v, want %q", tt.secret, err, tt.wantErr)
+		}
+	}
+}
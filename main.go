@@ -15,78 +15,356 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	echoServer "instagram/app/echoServer"
 	"instagram/app/echoServer/controller"
 	"instagram/app/echoServer/validation"
 	"instagram/config"
+	"instagram/model"
 	activityrepo "instagram/repository/activity"
+	commentrepo "instagram/repository/comment"
+	exportrepo "instagram/repository/export"
+	idempotencyrepo "instagram/repository/idempotency"
+	jobrepo "instagram/repository/job"
 	jokerepo "instagram/repository/joke"
+	keyrepo "instagram/repository/key"
 	likerepo "instagram/repository/like"
+	mfarepo "instagram/repository/mfa"
+	oidcrepo "instagram/repository/oidc"
 	postrepo "instagram/repository/post"
+	sessionrepo "instagram/repository/session"
+	tokenrepo "instagram/repository/token"
 	userrepo "instagram/repository/user"
+	webhookrepo "instagram/repository/webhook"
 	activitysvc "instagram/service/activity"
 	authsvc "instagram/service/auth"
+	exportsvc "instagram/service/export"
+	healthsvc "instagram/service/health"
+	idempotencysvc "instagram/service/idempotency"
+	jobsvc "instagram/service/job"
+	keysvc "instagram/service/key"
 	likesvc "instagram/service/like"
+	mfasvc "instagram/service/mfa"
 	postsvc "instagram/service/post"
+	sessionsvc "instagram/service/session"
+	tokensvc "instagram/service/token"
+	webhooksvc "instagram/service/webhook"
+	"instagram/util/auth"
+	"instagram/util/cache"
 	"instagram/util/database"
+	"instagram/util/httpx"
+	jwtutil "instagram/util/jwt"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/oidc"
+	"instagram/util/tracing"
+	"instagram/util/worker"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
 func main() {
+	printConfig := flag.Bool("print-config", false, "print the redacted effective config and exit")
+	flag.Parse()
 
-	cfg := config.Load()
-	ctx := context.Background()
-
-	db, err := database.New(ctx, cfg.DatabaseURL)
+	cfg, err := config.Load()
 	if err != nil {
-		slog.Error("db connect failed", "err", err)
+		slog.Error("invalid config", "err", err)
 		os.Exit(1)
 	}
+	if *printConfig {
+		fmt.Print(cfg.Dump())
+		return
+	}
+	slog.SetDefault(logger.New(os.Stdout, logger.Options{Level: cfg.LogLevel, Format: cfg.LogFormat}))
+	slog.Info("effective config", "config", cfg)
+
+	if err := run(cfg); err != nil {
+		slog.Error("server exited", "err", err)
+		os.Exit(1)
+	}
+}
+
+// run wires the app and serves until SIGINT/SIGTERM, then shuts down in
+// order: stop accepting and drain HTTP, stop workers, close the pool.
+func run(cfg config.App) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:     cfg.Tracing.Exporter,
+		File:         cfg.Tracing.File,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		ServiceName:  cfg.Tracing.ServiceName,
+		Environment:  cfg.Env,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("tracing setup failed: %w", err)
+	}
+	// Deferred first so it runs last, after the pool is closed.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("trace flush failed", "err", err)
+		}
+	}()
+
+	db, err := database.New(ctx, cfg.DatabaseURL, database.Options{
+		MaxConns:          cfg.DB.MaxConns,
+		MinConns:          cfg.DB.MinConns,
+		MaxConnLifetime:   cfg.DB.MaxConnLifetime,
+		MaxConnIdleTime:   cfg.DB.MaxConnIdleTime,
+		HealthCheckPeriod: cfg.DB.HealthCheckPeriod,
+		StatementTimeout:  cfg.DB.StatementTimeout,
+		ConnectRetries:    cfg.DB.ConnectRetries,
+		ConnectBackoff:    cfg.DB.ConnectBackoff,
+		Tracer:            tracing.PgxTracer{},
+	})
+	if err != nil {
+		return fmt.Errorf("db connect failed: %w", err)
+	}
 	defer db.Pool.Close()
+	if err := metrics.RegisterPool(db.Pool); err != nil {
+		return fmt.Errorf("register pool metrics: %w", err)
+	}
+
+	workers := worker.NewGroup()
+	// Every return from here on, a failed listen included, stops the
+	// workers before the pool closes under them. After a signal they are
+	// already stopped and this returns at once.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := workers.Stop(ctx); err != nil {
+			slog.Error("workers did not stop in time", "err", err)
+		}
+	}()
 
 	// repos
 	pr := postrepo.New(db)
 	lr := likerepo.New(db)
+	cr := commentrepo.New(db)
 	ar := activityrepo.New(db)
 	ur := userrepo.New(db)
-	jr := jokerepo.New(cfg.ApiNinjasKey)
+	// Sign-in and role checks read users uncached, so that a changed
+	// role takes effect on the next request.
+	aur := ur
+	if cfg.CacheTTL > 0 {
+		pr = postrepo.NewCached(pr, cache.NewLRU[int64, model.Post](cfg.CacheSize, cfg.CacheTTL))
+		ur = userrepo.NewCached(ur, cache.NewLRU[int64, model.User](cfg.CacheSize, cfg.CacheTTL))
+	}
+	ir := idempotencyrepo.New(db)
+	er := exportrepo.New(db)
+	qr := jobrepo.New(db)
+	wr := webhookrepo.New(db)
+	tr := tokenrepo.New(db)
+	or := oidcrepo.New(db)
+	kr := keyrepo.New(db)
+	mr := mfarepo.New(db)
+	srp := sessionrepo.New(db)
+	jr, err := newJokeRepo(cfg)
+	if err != nil {
+		return fmt.Errorf("joke provider %q init failed: %w", cfg.JokeProvider, err)
+	}
 
 	// services
-	ps := postsvc.New(pr, lr, ar, jr)
-	ls := likesvc.New(lr, pr, ar)
+	js := jobsvc.New(qr, jobsvc.Options{
+		Concurrency:  cfg.JobConcurrency,
+		PollInterval: cfg.JobPollInterval,
+		LockTimeout:  cfg.JobLockTimeout,
+		Retention:    cfg.JobRetention,
+		MaxAttempts:  cfg.JobMaxAttempts,
+	})
+	ws := webhooksvc.New(wr, aur, js, webhooksvc.Options{
+		Client:      httpx.UntrustedClient(cfg.WebhookAllowPrivate),
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		AllowHTTP:   cfg.Env == "dev",
+		Retention:   cfg.WebhookRetention,
+	})
+	ps := postsvc.New(pr, lr, cr, ur, ar, jr, ws, cfg.DeleteRestoreWindow)
+	ls := likesvc.New(lr, pr, ar, ws)
 	as := activitysvc.New(ar)
-	aus := authsvc.New(ur)
+	var op *oidc.Provider
+	if cfg.OIDCIssuer != "" {
+		op = oidc.New(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+			Client:       httpx.Client(),
+		})
+	}
+	keys := jwtutil.NewKeySet(cfg.JWTAlg, []byte(cfg.JWTSecret))
+	keySecret := cfg.JWTKeySecret
+	if keySecret == "" {
+		keySecret = cfg.JWTSecret
+	}
+	ks := keysvc.New(kr, keys, keysvc.Options{
+		Rotation: cfg.JWTKeyRotation,
+		TokenTTL: cfg.JWTTTL,
+		Secret:   []byte(keySecret),
+	})
+	if err := ks.Load(ctx); err != nil {
+		return fmt.Errorf("load jwt signing keys: %w", err)
+	}
+	tokens := auth.NewTokens(keys, auth.TokenOptions{
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		TTL:      cfg.JWTTTL,
+	})
+	mfaSecret := cfg.MFASecret
+	if mfaSecret == "" {
+		mfaSecret = cfg.JWTSecret
+	}
+	ms := mfasvc.New(mr, ur, mfasvc.Options{
+		Issuer: cfg.MFAIssuer,
+		Secret: []byte(mfaSecret),
+	})
+	sss := sessionsvc.New(srp, ar, cfg.JWTTTL)
+	aus := authsvc.New(aur, or, op, ms, sss, tokens)
+	ts := tokensvc.New(tr)
+	hs := healthsvc.New(db, jr, cfg.HealthUpstreamTTL)
+	is := idempotencysvc.New(ir, cfg.IdempotencyTTL, cfg.IdempotencyStaleAfter)
+	exportSecret := cfg.ExportURLSecret
+	if exportSecret == "" {
+		exportSecret = cfg.JWTSecret
+	}
+	es := exportsvc.New(er, ur, pr, lr, cr, ar, js, exportsvc.Options{
+		Dir:       cfg.ExportDir,
+		Retention: cfg.ExportRetention,
+		LinkTTL:   cfg.ExportLinkTTL,
+		Secret:    []byte(exportSecret),
+	})
+
+	// background jobs
+	js.Register(exportsvc.JobBuild, es.HandleBuild)
+	js.Register(webhooksvc.JobFanout, ws.HandleFanout)
+	js.Register(webhooksvc.JobDeliver, ws.HandleDeliver)
+	js.Register("posts.reconcile_like_counts", func(ctx context.Context, _ *model.Job) error {
+		n, err := ps.ReconcileLikeCounts(ctx)
+		if n > 0 {
+			logger.From(ctx).Warn("repaired drifted like counts", "posts", n)
+		}
+		return err
+	})
+	js.Register("posts.purge_deleted", func(ctx context.Context, _ *model.Job) error {
+		posts, likes, err := ps.PurgeDeleted(ctx, cfg.DeleteRetention)
+		if posts+likes > 0 {
+			logger.From(ctx).Info("purged deleted rows", "posts", posts, "likes", likes)
+		}
+		return err
+	})
+	js.Register("idempotency.purge", func(ctx context.Context, _ *model.Job) error {
+		n, err := is.Purge(ctx)
+		if n > 0 {
+			logger.From(ctx).Info("purged idempotency keys", "count", n)
+		}
+		return err
+	})
+	js.Register("data_export.purge", func(ctx context.Context, _ *model.Job) error {
+		n, err := es.Purge(ctx)
+		if n > 0 {
+			logger.From(ctx).Info("purged data exports", "count", n)
+		}
+		return err
+	})
+	js.Register(keysvc.JobRotate, func(ctx context.Context, _ *model.Job) error {
+		return ks.Rotate(ctx)
+	})
+	js.Register("sessions.purge", func(ctx context.Context, _ *model.Job) error {
+		n, err := sss.Purge(ctx)
+		if n > 0 {
+			logger.From(ctx).Info("purged ended sessions", "count", n)
+		}
+		return err
+	})
+	js.Register("webhook_deliveries.purge", func(ctx context.Context, _ *model.Job) error {
+		n, err := ws.Purge(ctx)
+		if n > 0 {
+			logger.From(ctx).Info("purged webhook deliveries", "count", n)
+		}
+		return err
+	})
+	js.Register("jobs.purge", func(ctx context.Context, _ *model.Job) error {
+		n, err := js.Purge(ctx)
+		if n > 0 {
+			logger.From(ctx).Info("purged finished jobs", "count", n)
+		}
+		return err
+	})
+	for kind, spec := range map[string]string{
+		"posts.reconcile_like_counts": "@every " + cfg.LikeReconcileInterval.String(),
+		"posts.purge_deleted":         "@hourly",
+		"idempotency.purge":           "@hourly",
+		"data_export.purge":           "@hourly",
+		"sessions.purge":              "@hourly",
+		"webhook_deliveries.purge":    "@hourly",
+		"jobs.purge":                  "@hourly",
+		keysvc.JobRotate:              "@hourly",
+	} {
+		if err := js.Schedule(spec, kind); err != nil {
+			return err
+		}
+	}
+	workers.Go("jobs", js.Run)
+	workers.Go("jwt-keys", ks.Run)
 
 	// controllers
 	pc := controller.NewPostController(ps)
 	lc := controller.NewLikeController(ls)
 	ac := controller.NewActivityController(as)
-	uc := controller.NewUserController(aus, cfg.JWTSecret, slog.Default())
+	uc := controller.NewUserController(aus)
+	hc := controller.NewHealthController(hs)
+	xc := controller.NewExportController(es)
+	jc := controller.NewJobController(js)
+	wc := controller.NewWebhookController(ws)
+	tc := controller.NewTokenController(ts)
+	kc := controller.NewKeyController(ks)
+	mc := controller.NewMFAController(ms)
+	sc := controller.NewSessionController(sss)
 
 	// echo
 	e := echo.New()
+	e.HideBanner = true
+	if e.IPExtractor, err = echoServer.IPExtractor(strings.Fields(cfg.TrustedProxies)); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
 	echoServer.RegisterMiddlewares(e)
 	e.Validator = validation.New()
 
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(200, map[string]any{
-			"status":  "ok",
-			"message": "Service is healthy and connected",
-		})
-	})
-
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	echoServer.Register(e, echoServer.C{
-		User:      uc,
-		Post:      pc,
-		Like:      lc,
-		Activity:  ac,
-		JWTSecret: cfg.JWTSecret,
+		User:     uc,
+		Post:     pc,
+		Like:     lc,
+		Activity: ac,
+		Health:   hc,
+		Export:   xc,
+		Job:      jc,
+		Webhook:  wc,
+		Token:    tc,
+		Key:      kc,
+		MFA:      mc,
+		Session:  sc,
+
+		Idempotency: echoServer.Idempotency(is),
+		Admin:       echoServer.RequireRole(aus.Role, model.RoleAdmin),
+		Auth:        echoServer.Authenticate(tokens, ts, sss),
+		SignInLimit: echoServer.RateLimit(cfg.OIDCStartRate),
 	})
 
 	port := os.Getenv("PORT")
@@ -99,5 +377,43 @@ func main() {
 
 	slog.Info("starting server", "PORT_env", os.Getenv("PORT"), "chosen_port", port)
 
-	e.Logger.Fatal(e.Start(":" + port))
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := e.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // a second signal now kills the process immediately
+
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	hs.Drain()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		slog.Error("http drain incomplete", "err", err)
+	}
+	if err := workers.Stop(shutdownCtx); err != nil {
+		slog.Error("workers did not stop in time", "err", err)
+	}
+	slog.Info("shutdown complete")
+	return nil
+}
+
+func newJokeRepo(cfg config.App) (jokerepo.Repo, error) {
+	switch cfg.JokeProvider {
+	case "", "api":
+		return jokerepo.New(cfg.JokeAPIURL, cfg.ApiNinjasKey), nil
+	case "offline":
+		return jokerepo.NewOffline(cfg.JokeFile)
+	default:
+		return nil, fmt.Errorf("unknown joke provider %q", cfg.JokeProvider)
+	}
 }
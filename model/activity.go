@@ -1,9 +1,60 @@
 package model
 
+import "time"
+
+// ActivityAction is what a user did. Values are stored verbatim in
+// user_activity_logs.action.
+type ActivityAction string
+
+const (
+	ActionPostCreate  ActivityAction = "POST_CREATE"
+	ActionPostDelete  ActivityAction = "POST_DELETE"
+	ActionPostRestore ActivityAction = "POST_RESTORE"
+	ActionLikeCreate  ActivityAction = "LIKE_CREATE"
+	ActionLikeDelete  ActivityAction = "LIKE_DELETE"
+	ActionDataExport  ActivityAction = "DATA_EXPORT"
+	// ActionNewDevice is a login from a device the user hasn't used
+	// before.
+	ActionNewDevice ActivityAction = "LOGIN_NEW_DEVICE"
+)
+
+// Target types in ActivityMetadata.
+const (
+	TargetPost       = "post"
+	TargetDataExport = "data_export"
+	TargetSession    = "session"
+)
+
+// ActivityMetadata is the queryable part of an activity, stored as JSONB.
+type ActivityMetadata struct {
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   int64  `json:"target_id,omitempty"`
+}
+
 type Activity struct {
-	ID          int64  `json:"id"`
-	UserID      int64  `json:"user_id"`
-	Action      string `json:"action"`
-	Description string `json:"description"`
-	CreatedAt   string `json:"created_at"`
+	ID          int64            `json:"id"`
+	UserID      int64            `json:"user_id"`
+	Action      ActivityAction   `json:"action"`
+	Description string           `json:"description"`
+	Metadata    ActivityMetadata `json:"metadata"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// ActivityFilter narrows GET /v1/activities. Zero fields don't filter.
+// Results are newest first; BeforeID continues from a previous page.
+type ActivityFilter struct {
+	Action     ActivityAction `validate:"omitempty,oneof=POST_CREATE POST_DELETE POST_RESTORE LIKE_CREATE LIKE_DELETE DATA_EXPORT LOGIN_NEW_DEVICE"`
+	TargetType string         `validate:"omitempty,oneof=post data_export session"`
+	TargetID   int64          `validate:"gte=0"`
+	From       time.Time
+	To         time.Time
+	BeforeID   int64 `validate:"gte=0"`
+	Limit      int   `validate:"omitempty,min=1,max=200"`
+}
+
+// ActivityPage is one page of activities. NextBeforeID is set when more
+// rows follow; pass it back as before_id.
+type ActivityPage struct {
+	Items        []Activity `json:"items"`
+	NextBeforeID *int64     `json:"next_before_id,omitempty"`
 }
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+type Comment struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	// Author is hydrated by the service, not stored.
+	Author *Profile `json:"author,omitempty"`
+}
+
+// CreateCommentReq is the comment creation payload
+// swagger:model CreateCommentReq
+type CreateCommentReq struct {
+	Content string `json:"content" validate:"required,max=2200"`
+}
+
+// CommentPage is one page of a post's comments, oldest first.
+type CommentPage struct {
+	Items  []Comment `json:"items"`
+	Total  int64     `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
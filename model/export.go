@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+	ExportExpired ExportStatus = "expired"
+)
+
+// DataExport is a user's request for a takeout archive of their data.
+type DataExport struct {
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"user_id"`
+	Status      ExportStatus `json:"status"`
+	SizeBytes   int64        `json:"size_bytes,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	// ExpiresAt is when a ready archive is deleted.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	FilePath  string     `json:"-"`
+
+	// DownloadURL is a signed link, valid until URLExpiresAt, set on
+	// ready exports in status responses.
+	DownloadURL  string     `json:"download_url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is a stored first response for an Idempotency-Key.
+// StatusCode is zero while the original request is still in flight.
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+func (r *IdempotencyRecord) Completed() bool { return r.StatusCode != 0 }
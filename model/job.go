@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	// JobDead jobs used up their attempts and wait for a manual retry.
+	JobDead JobStatus = "dead"
+)
+
+// Job is one unit of background work.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	Status      JobStatus       `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedAt    *time.Time      `json:"locked_at,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// LastAttempt reports whether a failure now would dead-letter the job.
+func (j *Job) LastAttempt() bool { return j.Attempts >= j.MaxAttempts }
+
+// JobFilter narrows the admin job list. Results are newest first.
+type JobFilter struct {
+	Status   JobStatus `validate:"omitempty,oneof=queued running done dead"`
+	Kind     string    `validate:"max=64"`
+	BeforeID int64     `validate:"gte=0"`
+	Limit    int       `validate:"omitempty,min=1,max=200"`
+}
+
+type JobPage struct {
+	Items        []Job  `json:"items"`
+	NextBeforeID *int64 `json:"next_before_id,omitempty"`
+}
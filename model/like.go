@@ -1,11 +1,14 @@
 package model
 
 import "time"
+
 type Like struct {
-	ID        int64  `json:"id"`
-	UserID    int64  `json:"user_id"`
-	PostID    int64  `json:"post_id"`
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	PostID    int64     `json:"post_id"`
 	CreatedAt time.Time `json:"created_at"`
+	// DeletedAt is only loaded for data exports.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateLikeReq struct {
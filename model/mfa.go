@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// TOTP is a user's authenticator app enrollment. Secret is sealed.
+type TOTP struct {
+	UserID         int64
+	Secret         []byte
+	EnabledAt      *time.Time
+	LastStep       int64
+	FailedAttempts int
+	LockedUntil    *time.Time
+	CreatedAt      time.Time
+}
+
+// TOTPEnrollment is returned when 2FA setup starts. Apps scan URI as a QR
+// code; Secret is for typing in by hand.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAStatus describes a user's 2FA setup.
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFACodeReq carries a code from the authenticator app or, where noted,
+// a recovery code.
+// swagger:model MFACodeReq
+type MFACodeReq struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// RecoveryCodes are shown once, when generated.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// LoginResult is a finished login (Token) or, for accounts with 2FA, a
+// challenge to answer at /v1/users/login/2fa.
+type LoginResult struct {
+	Token              string     `json:"token,omitempty"`
+	MFARequired        bool       `json:"mfa_required"`
+	ChallengeToken     string     `json:"challenge_token,omitempty"`
+	ChallengeExpiresAt *time.Time `json:"challenge_expires_at,omitempty"`
+	// DeviceID comes with Token; the client sends it on its next login.
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// MFALoginReq completes a 2FA login with an authenticator or recovery
+// code.
+// swagger:model MFALoginReq
+type MFALoginReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"`
+}
@@ -7,7 +7,14 @@ type Post struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	AuthorID  int64     `json:"author_id"`
+	LikeCount int64     `json:"like_count"`
 	CreatedAt time.Time `json:"created_at"`
+	LikedByMe bool      `json:"liked_by_me"`
+	// DeletedAt is only set on posts loaded for restore.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Author and RecentLikers are hydrated by the service, not stored.
+	Author       *Profile `json:"author,omitempty"`
+	RecentLikers []Liker  `json:"recent_likers,omitempty"`
 }
 
 // model/post.go
@@ -18,3 +25,34 @@ type CreatePostReq struct {
 	Title   string  `json:"title"`
 	Content *string `json:"content"`
 }
+
+// PostDetail is the GET /v1/posts/:id response.
+type PostDetail struct {
+	Post
+	Likers   LikerPage   `json:"likers"`
+	Comments CommentPage `json:"comments"`
+}
+
+// Liker is one user who liked a post.
+type Liker struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	LikedAt  time.Time `json:"liked_at"`
+}
+
+// LikerPage is one page of likers, newest first. Total is the post's
+// like count.
+type LikerPage struct {
+	Items  []Liker `json:"items"`
+	Total  int64   `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// DetailQuery pages the likers and comments embedded in PostDetail.
+type DetailQuery struct {
+	LikersLimit    int `query:"likers_limit" validate:"omitempty,min=1,max=100"`
+	LikersOffset   int `query:"likers_offset" validate:"min=0"`
+	CommentsLimit  int `query:"comments_limit" validate:"omitempty,min=1,max=100"`
+	CommentsOffset int `query:"comments_offset" validate:"min=0"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Session is a login on one device. Each login token belongs to one.
+type Session struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session the listing was requested with.
+	Current bool `json:"current"`
+	// DeviceID is the device the session started on; only its hash is
+	// stored, so it is only set on a new session.
+	DeviceID string `json:"-"`
+}
+
+// Client is where a login request came from.
+type Client struct {
+	UserAgent string
+	IP        string
+	// DeviceID is what the client was given at an earlier login, if
+	// anything.
+	DeviceID string
+}
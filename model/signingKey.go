@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// SigningKey is a stored JWT signing key. PrivateKey is sealed; only the
+// key service can open it.
+type SigningKey struct {
+	KID         string
+	Alg         string
+	PrivateKey  []byte
+	ActivatesAt time.Time
+	CreatedAt   time.Time
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Access token scopes.
+const (
+	ScopePostsRead      = "posts:read"
+	ScopePostsWrite     = "posts:write"
+	ScopeLikesWrite     = "likes:write"
+	ScopeActivitiesRead = "activities:read"
+)
+
+// AccessToken is a personal access token: a long-lived, scoped credential
+// for scripts, used in place of a login JWT.
+type AccessToken struct {
+	ID     int64    `json:"id"`
+	UserID int64    `json:"user_id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// Token is only returned when the token is created.
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the token grants scope.
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAccessTokenReq represents a new personal access token.
+// swagger:model CreateAccessTokenReq
+type CreateAccessTokenReq struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write likes:write activities:read"`
+	// ExpiresInDays defaults to 90.
+	ExpiresInDays int `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"`
+}
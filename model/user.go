@@ -9,11 +9,18 @@ type User struct {
 	Email        string    `json:"email"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
 // model/user.go
 
+// User roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // RegisterReq represents user registration payload
 // swagger:model RegisterReq
 type RegisterReq struct {
@@ -30,3 +37,25 @@ type LoginReq struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
+
+// Profile is the public view of a user, safe to embed in other responses.
+type Profile struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+func (u *User) Profile() Profile {
+	return Profile{ID: u.ID, Username: u.Username, FirstName: u.FirstName, LastName: u.LastName}
+}
+
+// UserIdentity links a user to an account at an external OpenID provider.
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
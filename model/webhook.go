@@ -0,0 +1,71 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook events.
+const (
+	EventPostCreated = "post.created"
+	EventPostDeleted = "post.deleted"
+	EventLikeCreated = "like.created"
+	EventLikeDeleted = "like.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to.
+var WebhookEvents = []string{EventPostCreated, EventPostDeleted, EventLikeCreated, EventLikeDeleted}
+
+// Webhook is a subscription to events that involve its owner, or every
+// user when Global is set.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Global    bool      `json:"global"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// CreateWebhookReq represents a webhook subscription.
+// swagger:model CreateWebhookReq
+type CreateWebhookReq struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=post.created post.deleted like.created like.deleted"`
+	// Secret signs deliveries; one is generated when empty.
+	Secret string `json:"secret,omitempty" validate:"omitempty,min=16,max=128"`
+	// Global subscribes to events for all users. Admins only.
+	Global bool `json:"global,omitempty"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent, or being sent, to one webhook.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int64  `json:"webhook_id"`
+	Event     string `json:"event"`
+	// Payload is the exact request body.
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	ReplayOf       *int64          `json:"replay_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type DeliveryPage struct {
+	Items        []WebhookDelivery `json:"items"`
+	NextBeforeID *int64            `json:"next_before_id,omitempty"`
+}
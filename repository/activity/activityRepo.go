@@ -2,14 +2,30 @@ package activityrepo
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"instagram/model"
 	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// exportBatch is how many rows Export fetches from its cursor at a time.
+const exportBatch = 500
+
 type Repo interface {
 	Log(ctx context.Context, a model.Activity) error
-	ListByUser(ctx context.Context, userID int64) ([]model.Activity, error)
+	// ListByUser returns up to f.Limit of the user's activities matching
+	// f, newest first.
+	ListByUser(ctx context.Context, userID int64, f model.ActivityFilter) ([]model.Activity, error)
+	// Export calls fn for every activity matching f, oldest first, reading
+	// through a server-side cursor so memory stays flat. f.Limit and
+	// f.BeforeID are ignored. A non-nil error from fn stops the export.
+	Export(ctx context.Context, userID int64, f model.ActivityFilter, fn func(model.Activity) error) error
 }
 
 type repo struct{ db *database.DB }
@@ -17,33 +33,135 @@ type repo struct{ db *database.DB }
 func New(db *database.DB) Repo { return &repo{db} }
 
 func (r *repo) Log(ctx context.Context, a model.Activity) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		INSERT INTO user_activity_logs(user_id, action, description)
-		VALUES ($1,$2,$3)`, a.UserID, a.Action, a.Description)
+	defer metrics.ObserveQuery("activity", "Log", time.Now())
+	meta, err := json.Marshal(a.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Pool.Exec(ctx, `
+		INSERT INTO user_activity_logs(user_id, action, description, metadata)
+		VALUES ($1,$2,$3,$4)`, a.UserID, a.Action, a.Description, meta)
 	return err
 }
 
-func (r *repo) ListByUser(ctx context.Context, userID int64) ([]model.Activity, error) {
-	rows, err := r.db.Pool.Query(ctx, `
+func (r *repo) ListByUser(ctx context.Context, userID int64, f model.ActivityFilter) ([]model.Activity, error) {
+	defer metrics.ObserveQuery("activity", "ListByUser", time.Now())
+
+	where, args, err := filterSQL(userID, f)
+	if err != nil {
+		return nil, err
+	}
+	if f.BeforeID != 0 {
+		args = append(args, f.BeforeID)
+		where += fmt.Sprintf(" AND id < $%d", len(args))
+	}
+	args = append(args, f.Limit)
+
+	rows, err := r.db.Pool.Query(ctx, fmt.Sprintf(`
 		SELECT 
-			id, user_id, action, description, created_at
+			id, user_id, action, description, metadata, created_at
 		FROM 
 			user_activity_logs
 		WHERE 
-			user_id=$1 
-		ORDER BY id DESC`, userID)
+			%s
+		ORDER BY id DESC
+		LIMIT $%d`, where, len(args)), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var out []model.Activity
+	out := []model.Activity{}
 	for rows.Next() {
 		var a model.Activity
-		if err := rows.Scan(&a.ID, &a.UserID, &a.Action, &a.Description, &a.CreatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Action, &a.Description, &a.Metadata, &a.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, a)
 	}
 	return out, rows.Err()
 }
+
+func (r *repo) Export(ctx context.Context, userID int64, f model.ActivityFilter, fn func(model.Activity) error) error {
+	defer metrics.ObserveQuery("activity", "Export", time.Now())
+
+	where, args, err := filterSQL(userID, f)
+	if err != nil {
+		return err
+	}
+
+	// Cursors only live inside a transaction.
+	tx, err := r.db.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`
+		DECLARE activity_export NO SCROLL CURSOR FOR
+		SELECT 
+			id, user_id, action, description, metadata, created_at
+		FROM 
+			user_activity_logs
+		WHERE 
+			%s
+		ORDER BY id`, where), args...); err != nil {
+		return err
+	}
+
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM activity_export", exportBatch))
+		if err != nil {
+			return err
+		}
+		n := 0
+		for rows.Next() {
+			n++
+			var a model.Activity
+			if err := rows.Scan(&a.ID, &a.UserID, &a.Action, &a.Description, &a.Metadata, &a.CreatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := fn(a); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportBatch {
+			return tx.Commit(ctx)
+		}
+	}
+}
+
+// filterSQL turns f (except paging) into a WHERE clause for the user's
+// activities and its arguments.
+func filterSQL(userID int64, f model.ActivityFilter) (string, []any, error) {
+	where := []string{"user_id=$1"}
+	args := []any{userID}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Action != "" {
+		add("action=$%d", f.Action)
+	}
+	if f.TargetType != "" || f.TargetID != 0 {
+		// Containment lets the GIN index on metadata serve the filter.
+		meta, err := json.Marshal(model.ActivityMetadata{TargetType: f.TargetType, TargetID: f.TargetID})
+		if err != nil {
+			return "", nil, err
+		}
+		add("metadata @> $%d::jsonb", meta)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	return strings.Join(where, " AND "), args, nil
+}
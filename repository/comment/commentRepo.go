@@ -0,0 +1,80 @@
+package commentrepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+)
+
+type Repo interface {
+	Create(ctx context.Context, c *model.Comment) error
+	// ListByPost pages through a post's comments, oldest first.
+	ListByPost(ctx context.Context, postID int64, limit, offset int) ([]model.Comment, error)
+	CountByPost(ctx context.Context, postID int64) (int64, error)
+	// AllByUser returns every comment userID wrote, for data exports.
+	AllByUser(ctx context.Context, userID int64) ([]model.Comment, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+func (r *repo) Create(ctx context.Context, c *model.Comment) error {
+	defer metrics.ObserveQuery("comment", "Create", time.Now())
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO comments(post_id, user_id, content)
+		VALUES ($1,$2,$3)
+		RETURNING id, created_at`,
+		c.PostID, c.UserID, c.Content,
+	).Scan(&c.ID, &c.CreatedAt)
+}
+
+func (r *repo) ListByPost(ctx context.Context, postID int64, limit, offset int) ([]model.Comment, error) {
+	defer metrics.ObserveQuery("comment", "ListByPost", time.Now())
+	return r.list(ctx, `
+		SELECT 
+			id, post_id, user_id, content, created_at
+		FROM 
+			comments
+		WHERE 
+			post_id=$1
+		ORDER BY id
+		LIMIT $2 OFFSET $3`, postID, limit, offset)
+}
+
+func (r *repo) CountByPost(ctx context.Context, postID int64) (int64, error) {
+	defer metrics.ObserveQuery("comment", "CountByPost", time.Now())
+	var n int64
+	err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM comments WHERE post_id=$1`, postID).Scan(&n)
+	return n, err
+}
+
+func (r *repo) AllByUser(ctx context.Context, userID int64) ([]model.Comment, error) {
+	defer metrics.ObserveQuery("comment", "AllByUser", time.Now())
+	return r.list(ctx, `
+		SELECT 
+			id, post_id, user_id, content, created_at
+		FROM 
+			comments WHERE user_id=$1 ORDER BY id`, userID)
+}
+
+func (r *repo) list(ctx context.Context, sql string, args ...any) ([]model.Comment, error) {
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Comment{}
+	for rows.Next() {
+		var c model.Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,125 @@
+package exportrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrActive is returned by Create when the user already has an export
+// pending or running.
+var ErrActive = errors.New("export already in progress")
+
+type Repo interface {
+	Create(ctx context.Context, userID int64) (*model.DataExport, error)
+	ByID(ctx context.Context, id int64) (*model.DataExport, error)
+	// Start marks a pending export running and returns it. Running exports
+	// are started again, since that means the previous build was abandoned.
+	// It returns pgx.ErrNoRows when the export is already finished.
+	Start(ctx context.Context, id int64) (*model.DataExport, error)
+	Complete(ctx context.Context, id int64, path string, size int64, expiresAt time.Time) error
+	Fail(ctx context.Context, id int64, msg string) error
+	// ExpireDue marks ready exports past expires_at expired and returns
+	// the archive paths to delete.
+	ExpireDue(ctx context.Context) ([]string, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+const columns = `id, user_id, status, COALESCE(file_path, ''), COALESCE(size_bytes, 0),
+			COALESCE(error, ''), created_at, completed_at, expires_at`
+
+func scan(row pgx.Row) (*model.DataExport, error) {
+	var e model.DataExport
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.SizeBytes,
+		&e.Error, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *repo) Create(ctx context.Context, userID int64) (*model.DataExport, error) {
+	defer metrics.ObserveQuery("export", "Create", time.Now())
+	e, err := scan(r.db.Pool.QueryRow(ctx, `
+		INSERT INTO data_exports(user_id)
+		VALUES ($1)
+		ON CONFLICT (user_id) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING `+columns, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrActive
+	}
+	return e, err
+}
+
+func (r *repo) ByID(ctx context.Context, id int64) (*model.DataExport, error) {
+	defer metrics.ObserveQuery("export", "ByID", time.Now())
+	return scan(r.db.Pool.QueryRow(ctx, `
+		SELECT `+columns+`
+		FROM 
+			data_exports WHERE id=$1`, id))
+}
+
+func (r *repo) Start(ctx context.Context, id int64) (*model.DataExport, error) {
+	defer metrics.ObserveQuery("export", "Start", time.Now())
+	return scan(r.db.Pool.QueryRow(ctx, `
+		UPDATE data_exports
+		SET status = 'running', started_at = NOW(), attempts = attempts + 1
+		WHERE id = $1 AND status IN ('pending', 'running')
+		RETURNING `+columns, id))
+}
+
+func (r *repo) Complete(ctx context.Context, id int64, path string, size int64, expiresAt time.Time) error {
+	defer metrics.ObserveQuery("export", "Complete", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE data_exports
+		SET status = 'ready', file_path = $2, size_bytes = $3, error = NULL,
+			completed_at = NOW(), expires_at = $4
+		WHERE id = $1`, id, path, size, expiresAt)
+	return err
+}
+
+func (r *repo) Fail(ctx context.Context, id int64, msg string) error {
+	defer metrics.ObserveQuery("export", "Fail", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE data_exports
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1`, id, msg)
+	return err
+}
+
+func (r *repo) ExpireDue(ctx context.Context) ([]string, error) {
+	defer metrics.ObserveQuery("export", "ExpireDue", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		WITH due AS (
+			SELECT id, file_path FROM data_exports
+			WHERE status = 'ready' AND expires_at < NOW()
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE data_exports d
+		SET status = 'expired', file_path = NULL
+		FROM due
+		WHERE d.id = due.id
+		RETURNING due.file_path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
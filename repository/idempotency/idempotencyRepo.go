@@ -0,0 +1,123 @@
+package idempotencyrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	// Claim reserves (userID, key) for a new request. claimed reports
+	// whether the caller now owns the key, in which case rec is its claim;
+	// otherwise rec is the record currently holding it. Expired records
+	// and in-flight records older than staleAfter (their request died
+	// without completing) are taken over.
+	Claim(ctx context.Context, userID int64, key, requestHash string, ttl, staleAfter time.Duration) (rec *model.IdempotencyRecord, claimed bool, err error)
+	// Complete and Release act only on the given claim, so a request whose
+	// key was taken over after it went stale can't touch the new owner's.
+	Complete(ctx context.Context, claim *model.IdempotencyRecord, status int, contentType string, body []byte) error
+	Release(ctx context.Context, claim *model.IdempotencyRecord) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+// claimAttempts bounds how often Claim retries when the key it lost to
+// is released before it can be read.
+const claimAttempts = 3
+
+func (r *repo) Claim(ctx context.Context, userID int64, key, requestHash string, ttl, staleAfter time.Duration) (*model.IdempotencyRecord, bool, error) {
+	defer metrics.ObserveQuery("idempotency", "Claim", time.Now())
+
+	for i := 0; ; i++ {
+		rec, claimed, err := r.claim(ctx, userID, key, requestHash, ttl, staleAfter)
+		if errors.Is(err, pgx.ErrNoRows) && i+1 < claimAttempts {
+			continue
+		}
+		return rec, claimed, err
+	}
+}
+
+// claim makes one attempt. It returns pgx.ErrNoRows when the record that
+// blocked the upsert was deleted before it could be read.
+func (r *repo) claim(ctx context.Context, userID int64, key, requestHash string, ttl, staleAfter time.Duration) (*model.IdempotencyRecord, bool, error) {
+	rec := model.IdempotencyRecord{UserID: userID, Key: key, RequestHash: requestHash}
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO idempotency_keys(user_id, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET
+			request_hash  = EXCLUDED.request_hash,
+			status_code   = NULL,
+			content_type  = NULL,
+			response_body = NULL,
+			completed_at  = NULL,
+			created_at    = NOW(),
+			expires_at    = EXCLUDED.expires_at
+		WHERE
+			idempotency_keys.expires_at < NOW()
+			OR (idempotency_keys.completed_at IS NULL
+				AND idempotency_keys.created_at < NOW() - make_interval(secs => $5))
+		RETURNING created_at, expires_at`,
+		userID, key, requestHash, ttl.Seconds(), staleAfter.Seconds(),
+	).Scan(&rec.CreatedAt, &rec.ExpiresAt)
+	if err == nil {
+		return &rec, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	var status *int
+	var contentType *string
+	if err := r.db.Pool.QueryRow(ctx, `
+		SELECT 
+			request_hash, status_code, content_type, response_body, created_at, expires_at
+		FROM 
+			idempotency_keys
+		WHERE 
+			user_id=$1 AND key=$2`, userID, key,
+	).Scan(&rec.RequestHash, &status, &contentType, &rec.Body, &rec.CreatedAt, &rec.ExpiresAt); err != nil {
+		return nil, false, err
+	}
+	if status != nil {
+		rec.StatusCode = *status
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+	return &rec, false, nil
+}
+
+func (r *repo) Complete(ctx context.Context, claim *model.IdempotencyRecord, status int, contentType string, body []byte) error {
+	defer metrics.ObserveQuery("idempotency", "Complete", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code=$5, content_type=$6, response_body=$7, completed_at=NOW()
+		WHERE user_id=$1 AND key=$2 AND request_hash=$3 AND created_at=$4 AND completed_at IS NULL`,
+		claim.UserID, claim.Key, claim.RequestHash, claim.CreatedAt, status, contentType, body)
+	return err
+}
+
+func (r *repo) Release(ctx context.Context, claim *model.IdempotencyRecord) error {
+	defer metrics.ObserveQuery("idempotency", "Release", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id=$1 AND key=$2 AND request_hash=$3 AND created_at=$4 AND completed_at IS NULL`,
+		claim.UserID, claim.Key, claim.RequestHash, claim.CreatedAt)
+	return err
+}
+
+func (r *repo) PurgeExpired(ctx context.Context) (int64, error) {
+	defer metrics.ObserveQuery("idempotency", "PurgeExpired", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	return cmd.RowsAffected(), err
+}
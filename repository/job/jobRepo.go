@@ -0,0 +1,210 @@
+package jobrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	// Enqueue inserts j and fills in its generated fields. created is
+	// false when a job with the same UniqueKey already exists.
+	Enqueue(ctx context.Context, j *model.Job) (created bool, err error)
+	// Claim locks up to limit runnable jobs of the given kinds for this
+	// worker. Running jobs locked before lockTimeout ago are runnable
+	// again: their worker is presumed dead.
+	Claim(ctx context.Context, kinds []string, limit int, lockTimeout time.Duration) ([]model.Job, error)
+	// Complete, Retry and Bury settle a claimed job. They do nothing (and
+	// report false) when the claim was lost to a reclaim.
+	Complete(ctx context.Context, j *model.Job) (bool, error)
+	Retry(ctx context.Context, j *model.Job, runAt time.Time, msg string) (bool, error)
+	Bury(ctx context.Context, j *model.Job, msg string) (bool, error)
+	// Release hands a claimed job back, runnable now, without using up
+	// the attempt it was claimed for.
+	Release(ctx context.Context, j *model.Job) (bool, error)
+	ByID(ctx context.Context, id int64) (*model.Job, error)
+	List(ctx context.Context, f model.JobFilter) ([]model.Job, error)
+	// Requeue resets a dead job's attempts and makes it runnable now.
+	Requeue(ctx context.Context, id int64) (*model.Job, error)
+	// PurgeFinished deletes done jobs finished before cutoff.
+	PurgeFinished(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+const columns = `id, kind, payload, status, attempts, max_attempts, run_at, locked_at,
+			COALESCE(last_error, ''), COALESCE(unique_key, ''), created_at, updated_at, finished_at`
+
+func scan(row pgx.Row) (model.Job, error) {
+	var j model.Job
+	err := row.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LockedAt,
+		&j.LastError, &j.UniqueKey, &j.CreatedAt, &j.UpdatedAt, &j.FinishedAt)
+	return j, err
+}
+
+func collect(rows pgx.Rows, err error) ([]model.Job, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Job{}
+	for rows.Next() {
+		j, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) Enqueue(ctx context.Context, j *model.Job) (bool, error) {
+	defer metrics.ObserveQuery("job", "Enqueue", time.Now())
+	var uniqueKey *string
+	if j.UniqueKey != "" {
+		uniqueKey = &j.UniqueKey
+	}
+	payload := j.Payload
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	got, err := scan(r.db.Pool.QueryRow(ctx, `
+		INSERT INTO jobs(kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING `+columns,
+		j.Kind, payload, j.MaxAttempts, j.RunAt, uniqueKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*j = got
+	return true, nil
+}
+
+func (r *repo) Claim(ctx context.Context, kinds []string, limit int, lockTimeout time.Duration) ([]model.Job, error) {
+	defer metrics.ObserveQuery("job", "Claim", time.Now())
+	return collect(r.db.Pool.Query(ctx, `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = clock_timestamp(), updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind = ANY($1)
+			  AND ((status = 'queued' AND run_at <= NOW())
+			    OR (status = 'running' AND locked_at < NOW() - make_interval(secs => $3)))
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT $2
+		)
+		RETURNING `+columns, kinds, limit, lockTimeout.Seconds()))
+}
+
+func (r *repo) Complete(ctx context.Context, j *model.Job) (bool, error) {
+	defer metrics.ObserveQuery("job", "Complete", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'done', locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_at = $2`, j.ID, j.LockedAt)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Retry(ctx context.Context, j *model.Job, runAt time.Time, msg string) (bool, error) {
+	defer metrics.ObserveQuery("job", "Retry", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'queued', locked_at = NULL, run_at = $3, last_error = $4, updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_at = $2`, j.ID, j.LockedAt, runAt, msg)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Bury(ctx context.Context, j *model.Job, msg string) (bool, error) {
+	defer metrics.ObserveQuery("job", "Bury", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'dead', locked_at = NULL, last_error = $3, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_at = $2`, j.ID, j.LockedAt, msg)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Release(ctx context.Context, j *model.Job) (bool, error) {
+	defer metrics.ObserveQuery("job", "Release", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'queued', attempts = GREATEST(attempts - 1, 0), locked_at = NULL, run_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running' AND locked_at = $2`, j.ID, j.LockedAt)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) ByID(ctx context.Context, id int64) (*model.Job, error) {
+	defer metrics.ObserveQuery("job", "ByID", time.Now())
+	j, err := scan(r.db.Pool.QueryRow(ctx, `
+		SELECT `+columns+`
+		FROM 
+			jobs WHERE id=$1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *repo) List(ctx context.Context, f model.JobFilter) ([]model.Job, error) {
+	defer metrics.ObserveQuery("job", "List", time.Now())
+	where := []string{"TRUE"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("status=$%d", f.Status)
+	}
+	if f.Kind != "" {
+		add("kind=$%d", f.Kind)
+	}
+	if f.BeforeID != 0 {
+		add("id < $%d", f.BeforeID)
+	}
+	args = append(args, f.Limit)
+	return collect(r.db.Pool.Query(ctx, fmt.Sprintf(`
+		SELECT `+columns+`
+		FROM 
+			jobs
+		WHERE 
+			%s
+		ORDER BY id DESC
+		LIMIT $%d`, strings.Join(where, " AND "), len(args)), args...))
+}
+
+func (r *repo) Requeue(ctx context.Context, id int64) (*model.Job, error) {
+	defer metrics.ObserveQuery("job", "Requeue", time.Now())
+	j, err := scan(r.db.Pool.QueryRow(ctx, `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), finished_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING `+columns, id))
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *repo) PurgeFinished(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer metrics.ObserveQuery("job", "PurgeFinished", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM jobs 
+		WHERE status = 'done' AND finished_at < $1`, cutoff)
+	return cmd.RowsAffected(), err
+}
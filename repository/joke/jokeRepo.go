@@ -5,57 +5,114 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"instagram/util/httpx"
+	"instagram/util/metrics"
 )
 
-const endpoint = "https://api.api-ninjas.com/v1/jokes?limit=1"
+const (
+	DefaultBaseURL = "https://api.api-ninjas.com"
+	jokesPath      = "/v1/jokes?limit=1"
+)
 
 type Repo interface {
 	FetchJoke(ctx context.Context) (string, error)
+	// Ping reports whether the provider is configured and reachable. It
+	// does not fetch a joke, so it costs no quota and is not counted in
+	// the joke API metrics.
+	Ping(ctx context.Context) error
 }
 
 type repo struct {
-	apiKey string
-	client *http.Client
+	baseURL  string
+	endpoint string
+	apiKey   string
+	client   *http.Client
 }
 
-func New(apiKey string) Repo {
+// New returns a Repo backed by the API-Ninjas jokes API. An empty baseURL
+// falls back to DefaultBaseURL, so tests and local setups can point it at
+// a stub server.
+func New(baseURL, apiKey string) Repo {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
 	return &repo{
-		apiKey: apiKey,
-		client: httpx.Client(),
+		baseURL:  baseURL,
+		endpoint: baseURL + jokesPath,
+		apiKey:   apiKey,
+		client:   httpx.Client(),
 	}
 }
 
 func (r *repo) FetchJoke(ctx context.Context) (string, error) {
 	if r.apiKey == "" {
+		metrics.JokeAPICalls.WithLabelValues("no_key").Inc()
 		return "", errors.New("API_NINJAS_KEY is empty")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	start := time.Now()
+	joke, outcome, err := r.fetch(ctx)
+	metrics.JokeAPIDuration.Observe(time.Since(start).Seconds())
+	metrics.JokeAPICalls.WithLabelValues(outcome).Inc()
+	return joke, err
+}
+
+// fetch performs the upstream call and classifies its outcome for metrics.
+func (r *repo) fetch(ctx context.Context) (joke, outcome string, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint, nil)
 	if err != nil {
-		return "", err
+		return "", "error", err
 	}
 	req.Header.Set("X-Api-Key", r.apiKey)
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return "", err
+		if ctx.Err() != nil {
+			return "", "canceled", err
+		}
+		return "", "error", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", errors.New("joke api non-200 response")
+		return "", "http_" + strconv.Itoa(resp.StatusCode), errors.New("joke api non-200 response")
 	}
 
 	var arr []struct {
 		Joke string `json:"joke"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&arr); err != nil {
-		return "", err
+		return "", "bad_response", err
 	}
 	if len(arr) == 0 || arr[0].Joke == "" {
-		return "", errors.New("no joke")
+		return "", "empty", errors.New("no joke")
+	}
+	return arr[0].Joke, "ok", nil
+}
+
+// Ping sends an unauthenticated HEAD to the API host: API-Ninjas has no
+// free status endpoint, and any answer short of a 5xx shows it is up.
+func (r *repo) Ping(ctx context.Context) error {
+	if r.apiKey == "" {
+		return errors.New("API_NINJAS_KEY is empty")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, r.baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.New("joke api status " + strconv.Itoa(resp.StatusCode))
 	}
-	return arr[0].Joke, nil
+	return nil
 }
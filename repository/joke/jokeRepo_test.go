@@ -0,0 +1,49 @@
+package joke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPingSpendsNoQuota(t *testing.T) {
+	var method, key string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, key = r.Method, r.Header.Get("X-Api-Key")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL, "k").Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if method != http.MethodHead || key != "" {
+		t.Errorf("request = %s with key %q, want HEAD without key", method, key)
+	}
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "instagram_joke_api_calls_total" && len(mf.GetMetric()) > 0 {
+			t.Errorf("Ping counted as a joke API call: %v", mf.GetMetric())
+		}
+	}
+}
+
+func TestPingReportsOutage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL, "k").Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded on a 502")
+	}
+	if err := New(srv.URL, "").Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded without an API key")
+	}
+}
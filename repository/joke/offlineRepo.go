@@ -0,0 +1,91 @@
+package joke
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strings"
+)
+
+//go:embed jokes.json
+var embeddedJokes []byte
+
+type offlineRepo struct{ jokes []string }
+
+// NewOffline returns a Repo that serves jokes from a local file instead of
+// the network. The file is either a JSON array (of strings or of
+// {"joke": "..."} objects, the same shape API-Ninjas returns) or plain text
+// with one joke per line. An empty path uses the built-in list.
+func NewOffline(path string) (Repo, error) {
+	data := embeddedJokes
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	jokes, err := parseJokes(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(jokes) == 0 {
+		return nil, errors.New("joke file has no jokes")
+	}
+	return &offlineRepo{jokes: jokes}, nil
+}
+
+func (r *offlineRepo) FetchJoke(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return r.jokes[rand.IntN(len(r.jokes))], nil
+}
+
+func (r *offlineRepo) Ping(ctx context.Context) error { return nil }
+
+func parseJokes(data []byte) ([]string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if data[0] != '[' {
+		var out []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			out = append(out, line)
+		}
+		return out, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		var s string
+		if err := json.Unmarshal(item, &s); err != nil {
+			var obj struct {
+				Joke string `json:"joke"`
+			}
+			if err := json.Unmarshal(item, &obj); err != nil {
+				return nil, err
+			}
+			s = obj.Joke
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
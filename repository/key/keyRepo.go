@@ -0,0 +1,81 @@
+package keyrepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+)
+
+type Repo interface {
+	// All returns every stored key, oldest activation first.
+	All(ctx context.Context) ([]model.SigningKey, error)
+	Create(ctx context.Context, k *model.SigningKey) error
+	// CreateFirst stores k only if there are no keys yet. Instances that
+	// boot together may both succeed, which is harmless: the later key
+	// signs and both verify.
+	CreateFirst(ctx context.Context, k *model.SigningKey) (bool, error)
+	// PurgeRetired deletes keys superseded by a key that activated more
+	// than maxTokenAge ago, so no unexpired token can name them.
+	PurgeRetired(ctx context.Context, maxTokenAge time.Duration) (int64, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+func (r *repo) All(ctx context.Context) ([]model.SigningKey, error) {
+	defer metrics.ObserveQuery("key", "All", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT 
+			kid, alg, private_key, activates_at, created_at
+		FROM 
+			jwt_signing_keys ORDER BY activates_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.SigningKey
+	for rows.Next() {
+		var k model.SigningKey
+		if err := rows.Scan(&k.KID, &k.Alg, &k.PrivateKey, &k.ActivatesAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) Create(ctx context.Context, k *model.SigningKey) error {
+	defer metrics.ObserveQuery("key", "Create", time.Now())
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO jwt_signing_keys(kid, alg, private_key, activates_at)
+		VALUES ($1,$2,$3,$4) RETURNING created_at`,
+		k.KID, k.Alg, k.PrivateKey, k.ActivatesAt,
+	).Scan(&k.CreatedAt)
+}
+
+func (r *repo) CreateFirst(ctx context.Context, k *model.SigningKey) (bool, error) {
+	defer metrics.ObserveQuery("key", "CreateFirst", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO jwt_signing_keys(kid, alg, private_key, activates_at)
+		SELECT $1,$2,$3,$4
+		WHERE NOT EXISTS (SELECT 1 FROM jwt_signing_keys)`,
+		k.KID, k.Alg, k.PrivateKey, k.ActivatesAt)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) PurgeRetired(ctx context.Context, maxTokenAge time.Duration) (int64, error) {
+	defer metrics.ObserveQuery("key", "PurgeRetired", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM jwt_signing_keys k
+		WHERE EXISTS (
+			SELECT 1 FROM jwt_signing_keys n
+			WHERE n.activates_at > k.activates_at
+				AND n.activates_at < NOW() - make_interval(secs => $1)
+		)`, maxTokenAge.Seconds())
+	return cmd.RowsAffected(), err
+}
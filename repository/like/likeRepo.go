@@ -2,17 +2,43 @@ package likerepo
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"instagram/model"
 	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrDuplicate is returned by Create when the user already likes the post.
+var ErrDuplicate = errors.New("like already exists")
+
+// Likes are soft-deleted: deleted_at hides a like from every read, and
+// liking again clears it on the same row.
 type Repo interface {
 	Create(ctx context.Context, userID, postID int64) (*model.Like, error)
+	// Upsert likes postID once; created is false when the like already
+	// existed, in which case the existing row is returned.
+	Upsert(ctx context.Context, userID, postID int64) (lk *model.Like, created bool, err error)
 	ByID(ctx context.Context, id int64) (*model.Like, error)
 	DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error)
+	DeleteByPostUser(ctx context.Context, postID, userID int64) (bool, error)
 	ListByPost(ctx context.Context, postID int64) ([]model.Like, error)
 	CountByPost(ctx context.Context, postID int64) (int64, error)
+	// ListLikers pages through a post's likers with their usernames.
+	ListLikers(ctx context.Context, postID int64, limit, offset int) ([]model.Liker, error)
+	// RecentLikers returns up to limit newest likers for each of postIDs.
+	RecentLikers(ctx context.Context, postIDs []int64, limit int) (map[int64][]model.Liker, error)
+	// LikedByUser reports which of postIDs userID has liked.
+	LikedByUser(ctx context.Context, userID int64, postIDs []int64) (map[int64]bool, error)
+	// AllByUser and AllOnPostsBy return likes given by and received by a
+	// user, deleted ones included, for data exports.
+	AllByUser(ctx context.Context, userID int64) ([]model.Like, error)
+	AllOnPostsBy(ctx context.Context, authorID int64) ([]model.Like, error)
+	// PurgeDeleted hard-deletes likes soft-deleted before cutoff.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error)
 }
 
 type repo struct{ db *database.DB }
@@ -20,25 +46,72 @@ type repo struct{ db *database.DB }
 func New(db *database.DB) Repo { return &repo{db} }
 
 func (r *repo) Create(ctx context.Context, userID, postID int64) (*model.Like, error) {
+	defer metrics.ObserveQuery("like", "Create", time.Now())
 	var lk model.Like
 	err := r.db.Pool.QueryRow(ctx, `
 		INSERT INTO likes(user_id, post_id)
-		VALUES ($1,$2) RETURNING id, user_id, post_id, created_at`,
+		VALUES ($1,$2)
+		ON CONFLICT (user_id, post_id) DO UPDATE
+			SET deleted_at = NULL, created_at = NOW()
+			WHERE likes.deleted_at IS NOT NULL
+		RETURNING id, user_id, post_id, created_at`,
 		userID, postID,
 	).Scan(&lk.ID, &lk.UserID, &lk.PostID, &lk.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDuplicate
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &lk, nil
 }
 
+func (r *repo) Upsert(ctx context.Context, userID, postID int64) (*model.Like, bool, error) {
+	defer metrics.ObserveQuery("like", "Upsert", time.Now())
+
+	// The fallback SELECT shares the statement snapshot, so a conflicting
+	// like committed by a concurrent request after it started is invisible
+	// and no row comes back; one retry sees it.
+	for attempt := 0; ; attempt++ {
+		var lk model.Like
+		var created bool
+		err := r.db.Pool.QueryRow(ctx, `
+			WITH ins AS (
+				INSERT INTO likes(user_id, post_id)
+				VALUES ($1,$2)
+				ON CONFLICT (user_id, post_id) DO UPDATE
+					SET deleted_at = NULL, created_at = NOW()
+					WHERE likes.deleted_at IS NOT NULL
+				RETURNING id, user_id, post_id, created_at
+			)
+			SELECT id, user_id, post_id, created_at, true FROM ins
+			UNION ALL
+			SELECT 
+				id, user_id, post_id, created_at, false
+			FROM 
+				likes
+			WHERE 
+				user_id=$1 AND post_id=$2 AND deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM ins)`,
+			userID, postID,
+		).Scan(&lk.ID, &lk.UserID, &lk.PostID, &lk.CreatedAt, &created)
+		if errors.Is(err, pgx.ErrNoRows) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return &lk, created, nil
+	}
+}
+
 func (r *repo) ByID(ctx context.Context, id int64) (*model.Like, error) {
+	defer metrics.ObserveQuery("like", "ByID", time.Now())
 	var lk model.Like
 	if err := r.db.Pool.QueryRow(ctx, `
 		SELECT 
 			id, user_id, post_id, created_at
 		FROM 
-			likes WHERE id=$1`, id,
+			likes WHERE id=$1 AND deleted_at IS NULL`, id,
 	).Scan(&lk.ID, &lk.UserID, &lk.PostID, &lk.CreatedAt); err != nil {
 		return nil, err
 	}
@@ -46,19 +119,30 @@ func (r *repo) ByID(ctx context.Context, id int64) (*model.Like, error) {
 }
 
 func (r *repo) DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error) {
+	defer metrics.ObserveQuery("like", "DeleteByIDOwner", time.Now())
 	cmd, err := r.db.Pool.Exec(ctx, `
-		DELETE FROM likes 
+		UPDATE likes SET deleted_at = NOW()
 		WHERE 
-			post_id=$1 AND user_id=$2`, id, ownerID)
+			id=$1 AND user_id=$2 AND deleted_at IS NULL`, id, ownerID)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) DeleteByPostUser(ctx context.Context, postID, userID int64) (bool, error) {
+	defer metrics.ObserveQuery("like", "DeleteByPostUser", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE likes SET deleted_at = NOW()
+		WHERE 
+			post_id=$1 AND user_id=$2 AND deleted_at IS NULL`, postID, userID)
 	return cmd.RowsAffected() > 0, err
 }
 
 func (r *repo) ListByPost(ctx context.Context, postID int64) ([]model.Like, error) {
+	defer metrics.ObserveQuery("like", "ListByPost", time.Now())
 	rows, err := r.db.Pool.Query(ctx, `
 		SELECT 
 			id, user_id, post_id, created_at
 		FROM 
-			likes WHERE post_id=$1 ORDER BY id DESC`, postID)
+			likes WHERE post_id=$1 AND deleted_at IS NULL ORDER BY id DESC`, postID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,12 +160,150 @@ func (r *repo) ListByPost(ctx context.Context, postID int64) ([]model.Like, erro
 }
 
 func (r *repo) CountByPost(ctx context.Context, postID int64) (int64, error) {
+	defer metrics.ObserveQuery("like", "CountByPost", time.Now())
 	var n int64
 	err := r.db.Pool.QueryRow(ctx, `SELECT 
 										COUNT(distinct ID) 
 									FROM 
 										likes 
 									WHERE 
-										post_id=$1`, postID).Scan(&n)
+										post_id=$1 AND deleted_at IS NULL`, postID).Scan(&n)
 	return n, err
 }
+
+func (r *repo) LikedByUser(ctx context.Context, userID int64, postIDs []int64) (map[int64]bool, error) {
+	defer metrics.ObserveQuery("like", "LikedByUser", time.Now())
+	out := make(map[int64]bool, len(postIDs))
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT 
+			post_id
+		FROM 
+			likes
+		WHERE 
+			user_id=$1 AND post_id = ANY($2) AND deleted_at IS NULL`, userID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) ListLikers(ctx context.Context, postID int64, limit, offset int) ([]model.Liker, error) {
+	defer metrics.ObserveQuery("like", "ListLikers", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT 
+			l.user_id, u.username, l.created_at
+		FROM 
+			likes l JOIN users u ON u.id = l.user_id
+		WHERE 
+			l.post_id=$1 AND l.deleted_at IS NULL
+		ORDER BY l.id DESC
+		LIMIT $2 OFFSET $3`, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Liker{}
+	for rows.Next() {
+		var lk model.Liker
+		if err := rows.Scan(&lk.UserID, &lk.Username, &lk.LikedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, lk)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) RecentLikers(ctx context.Context, postIDs []int64, limit int) (map[int64][]model.Liker, error) {
+	defer metrics.ObserveQuery("like", "RecentLikers", time.Now())
+	out := make(map[int64][]model.Liker, len(postIDs))
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT post_id, user_id, username, created_at
+		FROM (
+			SELECT 
+				l.post_id, l.user_id, u.username, l.created_at,
+				ROW_NUMBER() OVER (PARTITION BY l.post_id ORDER BY l.id DESC) AS rn
+			FROM 
+				likes l JOIN users u ON u.id = l.user_id
+			WHERE 
+				l.post_id = ANY($1) AND l.deleted_at IS NULL
+		) t
+		WHERE rn <= $2
+		ORDER BY post_id, rn`, postIDs, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int64
+		var lk model.Liker
+		if err := rows.Scan(&postID, &lk.UserID, &lk.Username, &lk.LikedAt); err != nil {
+			return nil, err
+		}
+		out[postID] = append(out[postID], lk)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer metrics.ObserveQuery("like", "PurgeDeleted", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM likes 
+		WHERE deleted_at < $1`, cutoff)
+	return cmd.RowsAffected(), err
+}
+
+func (r *repo) AllByUser(ctx context.Context, userID int64) ([]model.Like, error) {
+	defer metrics.ObserveQuery("like", "AllByUser", time.Now())
+	return r.listAll(ctx, `
+		SELECT 
+			id, user_id, post_id, created_at, deleted_at
+		FROM 
+			likes WHERE user_id=$1 ORDER BY id`, userID)
+}
+
+func (r *repo) AllOnPostsBy(ctx context.Context, authorID int64) ([]model.Like, error) {
+	defer metrics.ObserveQuery("like", "AllOnPostsBy", time.Now())
+	return r.listAll(ctx, `
+		SELECT 
+			l.id, l.user_id, l.post_id, l.created_at, l.deleted_at
+		FROM 
+			likes l JOIN posts p ON p.id = l.post_id
+		WHERE 
+			p.author_id=$1
+		ORDER BY l.id`, authorID)
+}
+
+func (r *repo) listAll(ctx context.Context, sql string, args ...any) ([]model.Like, error) {
+	rows, err := r.db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Like{}
+	for rows.Next() {
+		var lk model.Like
+		if err := rows.Scan(&lk.ID, &lk.UserID, &lk.PostID, &lk.CreatedAt, &lk.DeletedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, lk)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,161 @@
+package mfarepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	// ByUser returns userID's enrollment, or pgx.ErrNoRows.
+	ByUser(ctx context.Context, userID int64) (*model.TOTP, error)
+	// SaveSecret starts or restarts an enrollment. It changes nothing and
+	// reports false while 2FA is enabled.
+	SaveSecret(ctx context.Context, userID int64, secret []byte) (bool, error)
+	// Enable turns 2FA on, accepting step, and replaces the recovery codes.
+	Enable(ctx context.Context, userID, step int64, codeHashes []string) (bool, error)
+	// UseStep accepts a code's time step if it is newer than the last one
+	// accepted, and clears failed attempts.
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+	// UseRecoveryCode spends an unused recovery code and clears failed
+	// attempts.
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error)
+	// RecordFailure counts a wrong code; the maxAttempts-th locks 2FA
+	// checks for lock and starts the count again.
+	RecordFailure(ctx context.Context, userID int64, maxAttempts int, lock time.Duration) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	RecoveryCodesRemaining(ctx context.Context, userID int64) (int, error)
+	// Delete removes the enrollment and the recovery codes.
+	Delete(ctx context.Context, userID int64) (bool, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+func (r *repo) ByUser(ctx context.Context, userID int64) (*model.TOTP, error) {
+	defer metrics.ObserveQuery("mfa", "ByUser", time.Now())
+	var t model.TOTP
+	if err := r.db.Pool.QueryRow(ctx, `
+		SELECT 
+			user_id, secret, enabled_at, last_step, failed_attempts, locked_until, created_at
+		FROM 
+			user_totp WHERE user_id=$1`, userID,
+	).Scan(&t.UserID, &t.Secret, &t.EnabledAt, &t.LastStep, &t.FailedAttempts, &t.LockedUntil, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *repo) SaveSecret(ctx context.Context, userID int64, secret []byte) (bool, error) {
+	defer metrics.ObserveQuery("mfa", "SaveSecret", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO user_totp(user_id, secret)
+		VALUES ($1,$2)
+		ON CONFLICT (user_id) DO UPDATE
+			SET secret = EXCLUDED.secret, last_step = 0, failed_attempts = 0, locked_until = NULL, created_at = NOW()
+			WHERE user_totp.enabled_at IS NULL`, userID, secret)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Enable(ctx context.Context, userID, step int64, codeHashes []string) (bool, error) {
+	defer metrics.ObserveQuery("mfa", "Enable", time.Now())
+	var ok bool
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		cmd, err := tx.Exec(ctx, `
+			UPDATE user_totp SET enabled_at = NOW(), last_step = $2, failed_attempts = 0
+			WHERE 
+				user_id=$1 AND enabled_at IS NULL AND last_step < $2`, userID, step)
+		if err != nil || cmd.RowsAffected() == 0 {
+			return err
+		}
+		ok = true
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+	return ok, err
+}
+
+func (r *repo) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	defer metrics.ObserveQuery("mfa", "UseStep", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE user_totp SET last_step = $2, failed_attempts = 0
+		WHERE 
+			user_id=$1 AND last_step < $2`, userID, step)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	defer metrics.ObserveQuery("mfa", "UseRecoveryCode", time.Now())
+	var ok bool
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		cmd, err := tx.Exec(ctx, `
+			UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE 
+				user_id=$1 AND code_hash=$2 AND used_at IS NULL`, userID, hash)
+		if err != nil || cmd.RowsAffected() == 0 {
+			return err
+		}
+		ok = true
+		_, err = tx.Exec(ctx, `UPDATE user_totp SET failed_attempts = 0 WHERE user_id=$1`, userID)
+		return err
+	})
+	return ok, err
+}
+
+func (r *repo) RecordFailure(ctx context.Context, userID int64, maxAttempts int, lock time.Duration) error {
+	defer metrics.ObserveQuery("mfa", "RecordFailure", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE user_totp
+		SET 
+			failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN NOW() + make_interval(secs => $3) ELSE locked_until END
+		WHERE user_id=$1`, userID, maxAttempts, lock.Seconds())
+	return err
+}
+
+func (r *repo) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	defer metrics.ObserveQuery("mfa", "ReplaceRecoveryCodes", time.Now())
+	return pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_recovery_codes(user_id, code_hash)
+		SELECT $1, unnest($2::text[])`, userID, codeHashes)
+	return err
+}
+
+func (r *repo) RecoveryCodesRemaining(ctx context.Context, userID int64) (int, error) {
+	defer metrics.ObserveQuery("mfa", "RecoveryCodesRemaining", time.Now())
+	var n int
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT 
+			COUNT(*)
+		FROM 
+			user_recovery_codes WHERE user_id=$1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func (r *repo) Delete(ctx context.Context, userID int64) (bool, error) {
+	defer metrics.ObserveQuery("mfa", "Delete", time.Now())
+	var ok bool
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id=$1`, userID); err != nil {
+			return err
+		}
+		cmd, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id=$1`, userID)
+		ok = cmd.RowsAffected() > 0
+		return err
+	})
+	return ok, err
+}
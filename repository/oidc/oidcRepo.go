@@ -0,0 +1,111 @@
+package oidcrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrUsernameTaken is returned by CreateUser when u.Username is in use.
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrEmailTaken is returned by CreateUser when u.Email is in use.
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+type Repo interface {
+	// UserID returns the user linked to the identity.
+	UserID(ctx context.Context, issuer, subject string) (int64, error)
+	Link(ctx context.Context, id *model.UserIdentity) error
+	// CreateUser inserts u and links id to it in one transaction.
+	CreateUser(ctx context.Context, u *model.User, id *model.UserIdentity) error
+
+	// SaveState records a login in flight and drops ones older than ttl.
+	SaveState(ctx context.Context, state, nonce, verifier string, ttl time.Duration) error
+	// TakeState deletes and returns a login saved less than ttl ago.
+	TakeState(ctx context.Context, state string, ttl time.Duration) (nonce, verifier string, err error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+func (r *repo) UserID(ctx context.Context, issuer, subject string) (int64, error) {
+	defer metrics.ObserveQuery("oidc", "UserID", time.Now())
+	var id int64
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT 
+			user_id
+		FROM 
+			user_identities WHERE issuer=$1 AND subject=$2`, issuer, subject).Scan(&id)
+	return id, err
+}
+
+func (r *repo) Link(ctx context.Context, id *model.UserIdentity) error {
+	defer metrics.ObserveQuery("oidc", "Link", time.Now())
+	return link(ctx, r.db.Pool, id)
+}
+
+func (r *repo) CreateUser(ctx context.Context, u *model.User, id *model.UserIdentity) error {
+	defer metrics.ObserveQuery("oidc", "CreateUser", time.Now())
+	return pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO users(first_name, last_name, email, username, password_hash)
+			VALUES ($1,$2,$3,$4,$5)
+			RETURNING id, role, created_at`,
+			u.FirstName, u.LastName, u.Email, u.Username, u.PasswordHash,
+		).Scan(&u.ID, &u.Role, &u.CreatedAt)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			if pgErr.ConstraintName == "users_username_key" {
+				return ErrUsernameTaken
+			}
+			return ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		id.UserID = u.ID
+		return link(ctx, tx, id)
+	})
+}
+
+func link(ctx context.Context, q interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}, id *model.UserIdentity) error {
+	return q.QueryRow(ctx, `
+		INSERT INTO user_identities(user_id, issuer, subject, email)
+		VALUES ($1,$2,$3,NULLIF($4, ''))
+		RETURNING id, created_at`,
+		id.UserID, id.Issuer, id.Subject, id.Email,
+	).Scan(&id.ID, &id.CreatedAt)
+}
+
+func (r *repo) SaveState(ctx context.Context, state, nonce, verifier string, ttl time.Duration) error {
+	defer metrics.ObserveQuery("oidc", "SaveState", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		WITH expired AS (
+			DELETE FROM oidc_login_states WHERE created_at < NOW() - make_interval(secs => $4)
+		)
+		INSERT INTO oidc_login_states(state, nonce, code_verifier)
+		VALUES ($1,$2,$3)`, state, nonce, verifier, ttl.Seconds())
+	return err
+}
+
+func (r *repo) TakeState(ctx context.Context, state string, ttl time.Duration) (string, string, error) {
+	defer metrics.ObserveQuery("oidc", "TakeState", time.Now())
+	var nonce, verifier string
+	err := r.db.Pool.QueryRow(ctx, `
+		DELETE FROM oidc_login_states
+		WHERE state=$1 AND created_at >= NOW() - make_interval(secs => $2)
+		RETURNING nonce, code_verifier`, state, ttl.Seconds()).Scan(&nonce, &verifier)
+	return nonce, verifier, err
+}
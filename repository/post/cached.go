@@ -0,0 +1,43 @@
+package postrepo
+
+import (
+	"context"
+
+	"instagram/model"
+	"instagram/util/cache"
+)
+
+// Invalidator is implemented by Repos that cache posts. Services call it
+// after writes instead of waiting for the TTL.
+type Invalidator interface {
+	Invalidate(id int64)
+}
+
+// Cached serves ByID from an in-memory cache in front of another Repo.
+// The cached row includes like_count, so whoever changes a post or its
+// likes must call Invalidate.
+type Cached struct {
+	Repo
+	posts *cache.ReadThrough[int64, model.Post]
+}
+
+func NewCached(r Repo, c cache.Cache[int64, model.Post]) *Cached {
+	return &Cached{Repo: r, posts: cache.NewReadThrough("post", c)}
+}
+
+func (c *Cached) ByID(ctx context.Context, id int64) (*model.Post, error) {
+	p, err := c.posts.Get(ctx, id, func(ctx context.Context) (model.Post, error) {
+		p, err := c.Repo.ByID(ctx, id)
+		if err != nil {
+			return model.Post{}, err
+		}
+		return *p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Invalidate drops the cached copy of post id.
+func (c *Cached) Invalidate(id int64) { c.posts.Invalidate(id) }
@@ -2,16 +2,31 @@ package postrepo
 
 import (
 	"context"
+	"time"
 
 	"instagram/model"
 	"instagram/util/database"
+	"instagram/util/metrics"
 )
 
 type Repo interface {
 	Create(ctx context.Context, p *model.Post) error
 	All(ctx context.Context) ([]model.Post, error)
 	ByID(ctx context.Context, id int64) (*model.Post, error)
+	// DeleteByIDOwner soft-deletes a live post.
 	DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error)
+	// DeletedByID loads a post whether or not it is deleted, for restore.
+	DeletedByID(ctx context.Context, id int64) (*model.Post, error)
+	// RestoreByIDOwner undeletes a post deleted after since.
+	RestoreByIDOwner(ctx context.Context, id, ownerID int64, since time.Time) (bool, error)
+	// AllByAuthor returns every post by authorID, deleted ones included,
+	// for data exports.
+	AllByAuthor(ctx context.Context, authorID int64) ([]model.Post, error)
+	// PurgeDeleted hard-deletes posts soft-deleted before cutoff.
+	PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error)
+	// ReconcileLikeCounts recomputes like_count from likes and returns how
+	// many posts had drifted.
+	ReconcileLikeCounts(ctx context.Context) (int64, error)
 }
 
 type repo struct{ db *database.DB }
@@ -19,6 +34,7 @@ type repo struct{ db *database.DB }
 func New(db *database.DB) Repo { return &repo{db} }
 
 func (r *repo) Create(ctx context.Context, p *model.Post) error {
+	defer metrics.ObserveQuery("post", "Create", time.Now())
 	return r.db.Pool.QueryRow(ctx, `
 		INSERT INTO posts(title, content, author_id)
 		VALUES ($1,$2,$3) RETURNING id, created_at`,
@@ -27,11 +43,12 @@ func (r *repo) Create(ctx context.Context, p *model.Post) error {
 }
 
 func (r *repo) All(ctx context.Context) ([]model.Post, error) {
+	defer metrics.ObserveQuery("post", "All", time.Now())
 	rows, err := r.db.Pool.Query(ctx, `
 		SELECT 
-			id, title, content, author_id, created_at
+			id, title, content, author_id, like_count, created_at
 		FROM 
-			posts ORDER BY id DESC`)
+			posts WHERE deleted_at IS NULL ORDER BY id DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +57,7 @@ func (r *repo) All(ctx context.Context) ([]model.Post, error) {
 	var out []model.Post
 	for rows.Next() {
 		var p model.Post
-		if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.LikeCount, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, p)
@@ -49,21 +66,92 @@ func (r *repo) All(ctx context.Context) ([]model.Post, error) {
 }
 
 func (r *repo) ByID(ctx context.Context, id int64) (*model.Post, error) {
+	defer metrics.ObserveQuery("post", "ByID", time.Now())
 	var p model.Post
 	if err := r.db.Pool.QueryRow(ctx, `
 		SELECT 
-			id, title, content, author_id, created_at
+			id, title, content, author_id, like_count, created_at
+		FROM 
+			posts WHERE id=$1 AND deleted_at IS NULL`, id,
+	).Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.LikeCount, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *repo) DeletedByID(ctx context.Context, id int64) (*model.Post, error) {
+	defer metrics.ObserveQuery("post", "DeletedByID", time.Now())
+	var p model.Post
+	if err := r.db.Pool.QueryRow(ctx, `
+		SELECT 
+			id, title, content, author_id, like_count, created_at, deleted_at
 		FROM 
 			posts WHERE id=$1`, id,
-	).Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.CreatedAt); err != nil {
+	).Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.LikeCount, &p.CreatedAt, &p.DeletedAt); err != nil {
 		return nil, err
 	}
 	return &p, nil
 }
 
 func (r *repo) DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error) {
+	defer metrics.ObserveQuery("post", "DeleteByIDOwner", time.Now())
 	cmd, err := r.db.Pool.Exec(ctx, `
-		DELETE FROM posts 
-		WHERE id=$1 AND author_id=$2`, id, ownerID)
+		UPDATE posts SET deleted_at = NOW()
+		WHERE id=$1 AND author_id=$2 AND deleted_at IS NULL`, id, ownerID)
 	return cmd.RowsAffected() > 0, err
 }
+
+func (r *repo) RestoreByIDOwner(ctx context.Context, id, ownerID int64, since time.Time) (bool, error) {
+	defer metrics.ObserveQuery("post", "RestoreByIDOwner", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE posts SET deleted_at = NULL
+		WHERE id=$1 AND author_id=$2 AND deleted_at > $3`, id, ownerID, since)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) PurgeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer metrics.ObserveQuery("post", "PurgeDeleted", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM posts 
+		WHERE deleted_at < $1`, cutoff)
+	return cmd.RowsAffected(), err
+}
+
+func (r *repo) ReconcileLikeCounts(ctx context.Context) (int64, error) {
+	defer metrics.ObserveQuery("post", "ReconcileLikeCounts", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE posts p
+		SET like_count = c.n
+		FROM (
+			SELECT 
+				p2.id, COUNT(l.id) AS n
+			FROM 
+				posts p2 LEFT JOIN likes l ON l.post_id = p2.id AND l.deleted_at IS NULL
+			GROUP BY p2.id
+		) c
+		WHERE p.id = c.id AND p.like_count <> c.n`)
+	return cmd.RowsAffected(), err
+}
+
+func (r *repo) AllByAuthor(ctx context.Context, authorID int64) ([]model.Post, error) {
+	defer metrics.ObserveQuery("post", "AllByAuthor", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT 
+			id, title, content, author_id, like_count, created_at, deleted_at
+		FROM 
+			posts WHERE author_id=$1 ORDER BY id`, authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Post{}
+	for rows.Next() {
+		var p model.Post
+		if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.AuthorID, &p.LikeCount, &p.CreatedAt, &p.DeletedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
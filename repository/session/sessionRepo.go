@@ -0,0 +1,119 @@
+package sessionrepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	// Create stores s for the device with deviceKey and reports whether
+	// the user had no earlier session, live or not, on that device.
+	Create(ctx context.Context, s *model.Session, deviceKey string) (newDevice bool, err error)
+	// ByID returns the session whatever its state.
+	ByID(ctx context.Context, id int64) (*model.Session, error)
+	// ListActive returns userID's unrevoked, unexpired sessions, most
+	// recently used first.
+	ListActive(ctx context.Context, userID int64) ([]model.Session, error)
+	RevokeByIDOwner(ctx context.Context, id, ownerID int64) (bool, error)
+	// Touch records a use, at most once per interval.
+	Touch(ctx context.Context, id int64, interval time.Duration) error
+	// PurgeEnded deletes sessions that expired or were revoked before
+	// cutoff.
+	PurgeEnded(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+const columns = `id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at`
+
+func scan(row pgx.Row) (model.Session, error) {
+	var s model.Session
+	err := row.Scan(&s.ID, &s.UserID, &s.Device, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+	return s, err
+}
+
+func (r *repo) Create(ctx context.Context, s *model.Session, deviceKey string) (bool, error) {
+	defer metrics.ObserveQuery("session", "Create", time.Now())
+	var known bool
+	err := r.db.Pool.QueryRow(ctx, `
+		WITH known AS (
+			SELECT EXISTS (SELECT 1 FROM user_sessions WHERE user_id=$1 AND device_key=$6) AS seen
+		)
+		INSERT INTO user_sessions(user_id, device, user_agent, ip, expires_at, device_key)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING id, created_at, last_seen_at, (SELECT seen FROM known)`,
+		s.UserID, s.Device, s.UserAgent, s.IP, s.ExpiresAt, deviceKey,
+	).Scan(&s.ID, &s.CreatedAt, &s.LastSeenAt, &known)
+	return !known, err
+}
+
+func (r *repo) ByID(ctx context.Context, id int64) (*model.Session, error) {
+	defer metrics.ObserveQuery("session", "ByID", time.Now())
+	s, err := scan(r.db.Pool.QueryRow(ctx, `
+		SELECT `+columns+`
+		FROM 
+			user_sessions WHERE id=$1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *repo) ListActive(ctx context.Context, userID int64) ([]model.Session, error) {
+	defer metrics.ObserveQuery("session", "ListActive", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+columns+`
+		FROM 
+			user_sessions
+		WHERE 
+			user_id=$1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Session{}
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) RevokeByIDOwner(ctx context.Context, id, ownerID int64) (bool, error) {
+	defer metrics.ObserveQuery("session", "RevokeByIDOwner", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE user_sessions SET revoked_at = NOW()
+		WHERE 
+			id=$1 AND user_id=$2 AND revoked_at IS NULL AND expires_at > NOW()`, id, ownerID)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Touch(ctx context.Context, id int64, interval time.Duration) error {
+	defer metrics.ObserveQuery("session", "Touch", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE user_sessions SET last_seen_at = NOW()
+		WHERE id=$1 AND last_seen_at < NOW() - make_interval(secs => $2)`,
+		id, interval.Seconds())
+	return err
+}
+
+func (r *repo) PurgeEnded(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer metrics.ObserveQuery("session", "PurgeEnded", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM user_sessions 
+		WHERE expires_at < $1 OR revoked_at < $1`, cutoff)
+	return cmd.RowsAffected(), err
+}
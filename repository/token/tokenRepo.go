@@ -0,0 +1,97 @@
+package tokenrepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	// Create stores t under the hash of its secret.
+	Create(ctx context.Context, t *model.AccessToken, hash string) error
+	// ByHash returns the token with the given hash, whatever its state.
+	ByHash(ctx context.Context, hash string) (*model.AccessToken, error)
+	ListByUser(ctx context.Context, userID int64) ([]model.AccessToken, error)
+	RevokeByIDOwner(ctx context.Context, id, ownerID int64) (bool, error)
+	// Touch records a use, at most once per interval, to keep the write
+	// load of busy bots down.
+	Touch(ctx context.Context, id int64, interval time.Duration) error
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+const columns = `id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scan(row pgx.Row) (model.AccessToken, error) {
+	var t model.AccessToken
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	return t, err
+}
+
+func (r *repo) Create(ctx context.Context, t *model.AccessToken, hash string) error {
+	defer metrics.ObserveQuery("token", "Create", time.Now())
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens(user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING id, created_at`,
+		t.UserID, t.Name, hash, t.Prefix, t.Scopes, t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (r *repo) ByHash(ctx context.Context, hash string) (*model.AccessToken, error) {
+	defer metrics.ObserveQuery("token", "ByHash", time.Now())
+	t, err := scan(r.db.Pool.QueryRow(ctx, `
+		SELECT `+columns+`
+		FROM 
+			personal_access_tokens WHERE token_hash=$1`, hash))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *repo) ListByUser(ctx context.Context, userID int64) ([]model.AccessToken, error) {
+	defer metrics.ObserveQuery("token", "ListByUser", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+columns+`
+		FROM 
+			personal_access_tokens WHERE user_id=$1 ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.AccessToken{}
+	for rows.Next() {
+		t, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) RevokeByIDOwner(ctx context.Context, id, ownerID int64) (bool, error) {
+	defer metrics.ObserveQuery("token", "RevokeByIDOwner", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`, id, ownerID)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) Touch(ctx context.Context, id int64, interval time.Duration) error {
+	defer metrics.ObserveQuery("token", "Touch", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))`,
+		id, interval.Seconds())
+	return err
+}
@@ -0,0 +1,64 @@
+package userrepo
+
+import (
+	"context"
+
+	"instagram/model"
+	"instagram/util/cache"
+)
+
+// Cached serves ByID and ByIDs from an in-memory cache in front of
+// another Repo. ByEmail, used for login, always reads through.
+type Cached struct {
+	Repo
+	users *cache.ReadThrough[int64, model.User]
+}
+
+func NewCached(r Repo, c cache.Cache[int64, model.User]) *Cached {
+	return &Cached{Repo: r, users: cache.NewReadThrough("user", c)}
+}
+
+func (c *Cached) ByID(ctx context.Context, id int64) (*model.User, error) {
+	u, err := c.users.Get(ctx, id, func(ctx context.Context) (model.User, error) {
+		u, err := c.Repo.ByID(ctx, id)
+		if err != nil {
+			return model.User{}, err
+		}
+		return *u, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ByIDs answers what it can from the cache and loads the rest in one
+// query.
+func (c *Cached) ByIDs(ctx context.Context, ids []int64) (map[int64]model.User, error) {
+	out := make(map[int64]model.User, len(ids))
+	var missing []int64
+	for _, id := range ids {
+		if u, ok := c.users.Peek(id); ok {
+			out[id] = u
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	gen := c.users.Generation()
+	got, err := c.Repo.ByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, u := range got {
+		c.users.PutIfCurrent(gen, id, u)
+		out[id] = u
+	}
+	return out, nil
+}
+
+// Invalidate drops the cached copy of user id.
+func (c *Cached) Invalidate(id int64) { c.users.Invalidate(id) }
@@ -2,14 +2,19 @@ package userrepo
 
 import (
 	"context"
+	"time"
 
 	"instagram/model"
 	"instagram/util/database"
+	"instagram/util/metrics"
 )
 
 type Repo interface {
 	Create(ctx context.Context, u *model.User) error
 	ByEmail(ctx context.Context, email string) (*model.User, error)
+	ByID(ctx context.Context, id int64) (*model.User, error)
+	// ByIDs loads many users in one query; unknown IDs are left out.
+	ByIDs(ctx context.Context, ids []int64) (map[int64]model.User, error)
 }
 
 type repo struct{ db *database.DB }
@@ -17,24 +22,68 @@ type repo struct{ db *database.DB }
 func New(db *database.DB) Repo { return &repo{db} }
 
 func (r *repo) Create(ctx context.Context, u *model.User) error {
+	defer metrics.ObserveQuery("user", "Create", time.Now())
 	return r.db.Pool.QueryRow(ctx, `
 		INSERT INTO users(first_name, last_name, email, username, password_hash)
 		VALUES ($1,$2,$3,$4,$5)
-		RETURNING id, created_at`,
+		RETURNING id, role, created_at`,
 		u.FirstName, u.LastName, u.Email, u.Username, u.PasswordHash,
-	).Scan(&u.ID, &u.CreatedAt)
+	).Scan(&u.ID, &u.Role, &u.CreatedAt)
 }
 
 func (r *repo) ByEmail(ctx context.Context, email string) (*model.User, error) {
+	defer metrics.ObserveQuery("user", "ByEmail", time.Now())
 	u := &model.User{}
 	err := r.db.Pool.QueryRow(ctx, `
-        SELECT id, first_name, last_name, email, username, password_hash, created_at
+        SELECT id, first_name, last_name, email, username, password_hash, role, created_at
         FROM users
         WHERE lower(email) = lower($1)`,
 		email,
-	).Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Username, &u.PasswordHash, &u.CreatedAt)
+	).Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return u, nil
 }
+
+func (r *repo) ByID(ctx context.Context, id int64) (*model.User, error) {
+	defer metrics.ObserveQuery("user", "ByID", time.Now())
+	u := &model.User{}
+	err := r.db.Pool.QueryRow(ctx, `
+        SELECT id, first_name, last_name, email, username, password_hash, role, created_at
+        FROM users
+        WHERE id = $1`,
+		id,
+	).Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (r *repo) ByIDs(ctx context.Context, ids []int64) (map[int64]model.User, error) {
+	defer metrics.ObserveQuery("user", "ByIDs", time.Now())
+	out := make(map[int64]model.User, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+        SELECT id, first_name, last_name, email, username, password_hash, role, created_at
+        FROM users
+        WHERE id = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		out[u.ID] = u
+	}
+	return out, rows.Err()
+}
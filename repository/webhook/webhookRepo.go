@@ -0,0 +1,213 @@
+package webhookrepo
+
+import (
+	"context"
+	"time"
+
+	"instagram/model"
+	"instagram/util/database"
+	"instagram/util/metrics"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Repo interface {
+	Create(ctx context.Context, w *model.Webhook) error
+	// ByID returns the webhook with its secret.
+	ByID(ctx context.Context, id int64) (*model.Webhook, error)
+	ListByUser(ctx context.Context, userID int64) ([]model.Webhook, error)
+	DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error)
+
+	// CreateDeliveries records event eventID for every webhook subscribed
+	// to it and returns the delivery IDs. Calling it again for the same
+	// event returns the same deliveries.
+	CreateDeliveries(ctx context.Context, eventID int64, event string, userIDs []int64, payload []byte) ([]int64, error)
+	// CreateReplay copies a delivery as a new pending one.
+	CreateReplay(ctx context.Context, deliveryID int64) (*model.WebhookDelivery, error)
+	Delivery(ctx context.Context, id int64) (*model.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookID, beforeID int64, limit int) ([]model.WebhookDelivery, error)
+	// RecordAttempt stores the outcome of one send; status stays pending
+	// while retries remain.
+	RecordAttempt(ctx context.Context, id int64, status model.DeliveryStatus, respStatus *int, errMsg string) error
+	// PurgeDeliveries deletes settled deliveries created before cutoff.
+	PurgeDeliveries(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type repo struct{ db *database.DB }
+
+func New(db *database.DB) Repo { return &repo{db} }
+
+const webhookColumns = `id, user_id, url, events, global, created_at, secret`
+
+func scanWebhook(row pgx.Row) (model.Webhook, error) {
+	var w model.Webhook
+	err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Events, &w.Global, &w.CreatedAt, &w.Secret)
+	return w, err
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, response_status,
+			COALESCE(error, ''), replay_of, created_at, last_attempt_at, delivered_at`
+
+func scanDelivery(row pgx.Row) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus,
+		&d.Error, &d.ReplayOf, &d.CreatedAt, &d.LastAttemptAt, &d.DeliveredAt)
+	return d, err
+}
+
+func (r *repo) Create(ctx context.Context, w *model.Webhook) error {
+	defer metrics.ObserveQuery("webhook", "Create", time.Now())
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO webhooks(user_id, url, events, secret, global)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id, created_at`,
+		w.UserID, w.URL, w.Events, w.Secret, w.Global,
+	).Scan(&w.ID, &w.CreatedAt)
+}
+
+func (r *repo) ByID(ctx context.Context, id int64) (*model.Webhook, error) {
+	defer metrics.ObserveQuery("webhook", "ByID", time.Now())
+	w, err := scanWebhook(r.db.Pool.QueryRow(ctx, `
+		SELECT `+webhookColumns+`
+		FROM 
+			webhooks WHERE id=$1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *repo) ListByUser(ctx context.Context, userID int64) ([]model.Webhook, error) {
+	defer metrics.ObserveQuery("webhook", "ListByUser", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+webhookColumns+`
+		FROM 
+			webhooks WHERE user_id=$1 ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) DeleteByIDOwner(ctx context.Context, id, ownerID int64) (bool, error) {
+	defer metrics.ObserveQuery("webhook", "DeleteByIDOwner", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM webhooks WHERE id=$1 AND user_id=$2`, id, ownerID)
+	return cmd.RowsAffected() > 0, err
+}
+
+func (r *repo) CreateDeliveries(ctx context.Context, eventID int64, event string, userIDs []int64, payload []byte) ([]int64, error) {
+	defer metrics.ObserveQuery("webhook", "CreateDeliveries", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		WITH ins AS (
+			INSERT INTO webhook_deliveries(webhook_id, event_id, event, payload)
+			SELECT 
+				id, $1::bigint, $2::varchar, $4::jsonb
+			FROM 
+				webhooks
+			WHERE 
+				$2 = ANY(events) AND (global OR user_id = ANY($3))
+			ON CONFLICT (webhook_id, event_id) DO NOTHING
+			RETURNING id
+		)
+		SELECT id FROM ins
+		UNION
+		SELECT id FROM webhook_deliveries WHERE event_id = $1`,
+		eventID, event, userIDs, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) CreateReplay(ctx context.Context, deliveryID int64) (*model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "CreateReplay", time.Now())
+	d, err := scanDelivery(r.db.Pool.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries(webhook_id, event, payload, replay_of)
+		SELECT 
+			webhook_id, event, payload, id
+		FROM 
+			webhook_deliveries WHERE id=$1
+		RETURNING `+deliveryColumns, deliveryID))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *repo) Delivery(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "Delivery", time.Now())
+	d, err := scanDelivery(r.db.Pool.QueryRow(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM 
+			webhook_deliveries WHERE id=$1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *repo) ListDeliveries(ctx context.Context, webhookID, beforeID int64, limit int) ([]model.WebhookDelivery, error) {
+	defer metrics.ObserveQuery("webhook", "ListDeliveries", time.Now())
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM 
+			webhook_deliveries
+		WHERE 
+			webhook_id=$1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3`, webhookID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) RecordAttempt(ctx context.Context, id int64, status model.DeliveryStatus, respStatus *int, errMsg string) error {
+	defer metrics.ObserveQuery("webhook", "RecordAttempt", time.Now())
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, response_status = $3, error = NULLIF($4, ''),
+			last_attempt_at = NOW(),
+			delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id = $1`, id, status, respStatus, errMsg)
+	return err
+}
+
+func (r *repo) PurgeDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	defer metrics.ObserveQuery("webhook", "PurgeDeliveries", time.Now())
+	cmd, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM webhook_deliveries 
+		WHERE status <> 'pending' AND created_at < $1`, cutoff)
+	return cmd.RowsAffected(), err
+}
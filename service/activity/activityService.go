@@ -5,16 +5,48 @@ import (
 
 	"instagram/model"
 	activityrepo "instagram/repository/activity"
+	"instagram/util/tracing"
 )
 
+const defaultPageSize = 50
+
 type Service interface {
-	ListMine(ctx context.Context, userID int64) ([]model.Activity, error)
+	ListMine(ctx context.Context, userID int64, f model.ActivityFilter) (*model.ActivityPage, error)
+	// ExportMine streams every matching activity, oldest first, to fn.
+	ExportMine(ctx context.Context, userID int64, f model.ActivityFilter, fn func(model.Activity) error) error
 }
 
 type service struct{ ar activityrepo.Repo }
 
 func New(ar activityrepo.Repo) Service { return &service{ar} }
 
-func (s *service) ListMine(ctx context.Context, userID int64) ([]model.Activity, error) {
-	return s.ar.ListByUser(ctx, userID)
+func (s *service) ListMine(ctx context.Context, userID int64, f model.ActivityFilter) (*model.ActivityPage, error) {
+	ctx, span := tracing.Start(ctx, "activitysvc.ListMine")
+	defer span.End()
+
+	if f.Limit == 0 {
+		f.Limit = defaultPageSize
+	}
+	limit := f.Limit
+	// One extra row tells whether another page follows.
+	f.Limit++
+	acts, err := s.ar.ListByUser(ctx, userID, f)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.ActivityPage{Items: acts}
+	if len(acts) > limit {
+		page.Items = acts[:limit]
+		next := page.Items[limit-1].ID
+		page.NextBeforeID = &next
+	}
+	return page, nil
+}
+
+func (s *service) ExportMine(ctx context.Context, userID int64, f model.ActivityFilter, fn func(model.Activity) error) error {
+	ctx, span := tracing.Start(ctx, "activitysvc.ExportMine")
+	defer span.End()
+
+	return s.ar.Export(ctx, userID, f, fn)
 }
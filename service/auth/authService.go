@@ -8,11 +8,17 @@ import (
 	"github.com/jackc/pgerrcode"
 
 	"instagram/model"
+	oidcrepo "instagram/repository/oidc"
 	userrepo "instagram/repository/user"
+	mfasvc "instagram/service/mfa"
+	sessionsvc "instagram/service/session"
+	"instagram/util/auth"
 	"instagram/util/hash"
-	jwtutil "instagram/util/jwt"
+	"instagram/util/metrics"
+	"instagram/util/oidc"
+	"instagram/util/tracing"
 
-	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
@@ -20,21 +26,59 @@ var (
 	ErrBadInput      = errors.New("bad input")
 	ErrInvalidCreds  = errors.New("invalid credentials")
 	ErrUsernameTaken = errors.New("username already taken")
+
+	ErrOIDCDisabled = errors.New("single sign-on is not configured")
+	ErrOIDCState    = errors.New("sign-in expired or already completed")
+	ErrOIDCFailed   = errors.New("sign-in with the provider failed")
+	ErrOIDCNoEmail  = errors.New("provider did not share an email address")
+
+	ErrMFAChallenge = errors.New("two-factor sign-in expired; sign in again")
 )
 
 type Service interface {
-	Register(ctx context.Context, req model.RegisterReq, secret string) (*model.User, string, error)
-	Login(ctx context.Context, req model.LoginReq, secret string) (*model.User, string, error)
+	Register(ctx context.Context, req model.RegisterReq) (*model.User, error)
+	// Login checks the password and starts a session for client. For
+	// accounts with 2FA the result is a challenge for LoginMFA rather than
+	// a token, and the session starts there.
+	Login(ctx context.Context, req model.LoginReq, client model.Client) (*model.User, *model.LoginResult, error)
+	// LoginMFA answers a login challenge with an authenticator or recovery
+	// code and issues the login token.
+	LoginMFA(ctx context.Context, req model.MFALoginReq, client model.Client) (*model.User, *model.LoginResult, error)
+	// Role is userID's current role; tokens carry the role they were
+	// issued with, which may since have changed.
+	Role(ctx context.Context, userID int64) (string, error)
+
+	// OIDCStart begins a sign-in with the OpenID provider and returns the
+	// URL to send the browser to and the state it will come back with. The
+	// caller must bind the state to the browser and check it comes back
+	// from the same one.
+	OIDCStart(ctx context.Context) (authURL, state string, err error)
+	// OIDCCallback completes it: it redeems the code, finds or creates the
+	// linked user and finishes like Login, 2FA included.
+	OIDCCallback(ctx context.Context, code, state string, client model.Client) (*model.User, *model.LoginResult, error)
 }
 
-type service struct{ ur userrepo.Repo }
+type service struct {
+	ur userrepo.Repo
+	or oidcrepo.Repo
+	// op is nil when no OpenID provider is configured.
+	op       *oidc.Provider
+	mfa      mfasvc.Service
+	sessions sessionsvc.Service
+	tokens   *auth.Tokens
+}
 
-func New(ur userrepo.Repo) Service { return &service{ur} }
+func New(ur userrepo.Repo, or oidcrepo.Repo, op *oidc.Provider, mfa mfasvc.Service, sessions sessionsvc.Service, tokens *auth.Tokens) Service {
+	return &service{ur: ur, or: or, op: op, mfa: mfa, sessions: sessions, tokens: tokens}
+}
+
+func (s *service) Register(ctx context.Context, req model.RegisterReq) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.Register")
+	defer span.End()
 
-func (s *service) Register(ctx context.Context, req model.RegisterReq, secret string) (*model.User, string, error) {
 	hashed, err := hash.HashPassword(req.Password)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	u := &model.User{
@@ -47,16 +91,12 @@ func (s *service) Register(ctx context.Context, req model.RegisterReq, secret st
 
 	if err := s.ur.Create(ctx, u); err != nil {
 		if derr := mapDuplicateErr(err); derr != nil {
-			return nil, "", derr
+			return nil, derr
 		}
-		return nil, "", err
-	}
-
-	token, err := jwtutil.Issue(secret, u.ID, "user", 24)
-	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	return u, token, nil
+	metrics.Registrations.Inc()
+	return u, nil
 }
 
 func mapDuplicateErr(err error) error {
@@ -78,17 +118,33 @@ func mapDuplicateErr(err error) error {
 	return nil
 }
 
-func (s *service) Login(ctx context.Context, req model.LoginReq, secret string) (*model.User, string, error) {
+func (s *service) Login(ctx context.Context, req model.LoginReq, client model.Client) (*model.User, *model.LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.Login")
+	defer span.End()
+
 	u, err := s.ur.ByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, "", ErrInvalidCreds
+		metrics.Logins.WithLabelValues("invalid_credentials").Inc()
+		return nil, nil, ErrInvalidCreds
 	}
 	if !hash.Check(u.PasswordHash, req.Password) {
-		return nil, "", ErrInvalidCreds
+		metrics.Logins.WithLabelValues("invalid_credentials").Inc()
+		return nil, nil, ErrInvalidCreds
+	}
+	res, err := s.signIn(ctx, u, client, "success")
+	if err != nil {
+		return nil, nil, err
 	}
-	token, err := jwtutil.Issue(secret, u.ID, "user", 24)
+	return u, res, nil
+}
+
+func (s *service) Role(ctx context.Context, userID int64) (string, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.Role")
+	defer span.End()
+
+	u, err := s.ur.ByID(ctx, userID)
 	if err != nil {
-		return nil, "", err
+		return "", err
 	}
-	return u, token, nil
+	return u.Role, nil
 }
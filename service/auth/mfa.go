@@ -0,0 +1,78 @@
+package authsvc
+
+import (
+	"context"
+	"errors"
+
+	"instagram/model"
+	mfasvc "instagram/service/mfa"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
+)
+
+// signIn finishes a login by u from client once its first factor checked
+// out: a session and its login token, or a challenge when u has 2FA on.
+// result labels the login metric for a finished login.
+func (s *service) signIn(ctx context.Context, u *model.User, client model.Client, result string) (*model.LoginResult, error) {
+	on, err := s.mfa.Enabled(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if on {
+		tok, exp, err := s.tokens.IssueChallenge(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		metrics.Logins.WithLabelValues("mfa_required").Inc()
+		return &model.LoginResult{MFARequired: true, ChallengeToken: tok, ChallengeExpiresAt: &exp}, nil
+	}
+
+	res, err := s.issue(ctx, u, client)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Logins.WithLabelValues(result).Inc()
+	return res, nil
+}
+
+func (s *service) LoginMFA(ctx context.Context, req model.MFALoginReq, client model.Client) (*model.User, *model.LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.LoginMFA")
+	defer span.End()
+
+	uid, err := s.tokens.VerifyChallenge(req.ChallengeToken)
+	if err != nil {
+		return nil, nil, errors.Join(ErrMFAChallenge, err)
+	}
+	err = s.mfa.Verify(ctx, uid, req.Code)
+	if errors.Is(err, mfasvc.ErrNotEnabled) {
+		// 2FA was turned off since the challenge; a fresh login needs none.
+		return nil, nil, ErrMFAChallenge
+	}
+	if err != nil {
+		metrics.Logins.WithLabelValues("mfa_failed").Inc()
+		return nil, nil, err
+	}
+	u, err := s.ur.ByID(ctx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.issue(ctx, u, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	metrics.Logins.WithLabelValues("mfa_success").Inc()
+	return u, res, nil
+}
+
+// issue starts a session for u on client and signs its login token.
+func (s *service) issue(ctx context.Context, u *model.User, client model.Client) (*model.LoginResult, error) {
+	sess, err := s.sessions.Start(ctx, u.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.tokens.Issue(u.ID, u.Role, sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{Token: token, DeviceID: sess.DeviceID}, nil
+}
@@ -0,0 +1,179 @@
+package authsvc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"instagram/model"
+	oidcrepo "instagram/repository/oidc"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/oidc"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OIDCStateTTL is how long the user has to sign in at the provider.
+const OIDCStateTTL = 10 * time.Minute
+
+const (
+	// usernameAttempts bounds the random suffixes tried when the
+	// provider's username is taken.
+	usernameAttempts = 5
+	maxUsernameLen   = 32
+)
+
+func (s *service) OIDCStart(ctx context.Context) (string, string, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.OIDCStart")
+	defer span.End()
+
+	if s.op == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	state, nonce := oidc.RandomString(), oidc.RandomString()
+	verifier, challenge := oidc.NewPKCE()
+	if err := s.or.SaveState(ctx, state, nonce, verifier, OIDCStateTTL); err != nil {
+		return "", "", err
+	}
+	u, err := s.op.AuthURL(ctx, state, nonce, challenge)
+	if errors.Is(err, oidc.ErrProvider) {
+		return "", "", fmt.Errorf("%w: %w", ErrOIDCFailed, err)
+	}
+	return u, state, err
+}
+
+func (s *service) OIDCCallback(ctx context.Context, code, state string, client model.Client) (*model.User, *model.LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "authsvc.OIDCCallback")
+	defer span.End()
+
+	if s.op == nil {
+		return nil, nil, ErrOIDCDisabled
+	}
+	nonce, verifier, err := s.or.TakeState(ctx, state, OIDCStateTTL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrOIDCState
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := s.op.Exchange(ctx, code, verifier, nonce)
+	if errors.Is(err, oidc.ErrProvider) {
+		metrics.Logins.WithLabelValues("oidc_failed").Inc()
+		return nil, nil, fmt.Errorf("%w: %w", ErrOIDCFailed, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := s.oidcUser(ctx, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.signIn(ctx, u, client, "oidc_success")
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, res, nil
+}
+
+// oidcUser finds the user linked to the identity in claims. An unlinked
+// identity is linked to the account with the same email if the provider
+// verified that email, and gets a new account otherwise.
+func (s *service) oidcUser(ctx context.Context, c *oidc.Claims) (*model.User, error) {
+	issuer := s.op.Issuer()
+	uid, err := s.or.UserID(ctx, issuer, c.Subject)
+	if err == nil {
+		return s.ur.ByID(ctx, uid)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	if c.Email == "" {
+		return nil, ErrOIDCNoEmail
+	}
+	id := &model.UserIdentity{Issuer: issuer, Subject: c.Subject, Email: c.Email}
+	existing, err := s.ur.ByEmail(ctx, c.Email)
+	switch {
+	case err == nil:
+		if !c.EmailVerified {
+			// Anyone can claim an address at some providers; linking on
+			// it would hand them the account.
+			return nil, ErrEmailTaken
+		}
+		id.UserID = existing.ID
+		if err := s.or.Link(ctx, id); err != nil {
+			return nil, err
+		}
+		logger.From(ctx).Info("linked external identity", "user_id", existing.ID, "issuer", issuer)
+		return existing, nil
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, err
+	}
+
+	first, last := c.GivenName, c.FamilyName
+	if first == "" && last == "" {
+		first, last, _ = strings.Cut(c.Name, " ")
+	}
+	base := usernameBase(c)
+	for attempt := 0; ; attempt++ {
+		u := &model.User{
+			FirstName: first,
+			LastName:  last,
+			Email:     c.Email,
+			Username:  base,
+			// No password: the account signs in through the provider.
+			PasswordHash: "",
+		}
+		if attempt > 0 {
+			var b [2]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				return nil, err
+			}
+			u.Username = base + "_" + hex.EncodeToString(b[:])
+		}
+		err := s.or.CreateUser(ctx, u, id)
+		if errors.Is(err, oidcrepo.ErrUsernameTaken) && attempt < usernameAttempts {
+			continue
+		}
+		if errors.Is(err, oidcrepo.ErrUsernameTaken) {
+			return nil, ErrUsernameTaken
+		}
+		if errors.Is(err, oidcrepo.ErrEmailTaken) {
+			return nil, ErrEmailTaken
+		}
+		if err != nil {
+			return nil, err
+		}
+		metrics.Registrations.Inc()
+		return u, nil
+	}
+}
+
+// usernameBase derives a username from the provider's claims, keeping
+// only characters safe in URLs and mentions.
+func usernameBase(c *oidc.Claims) string {
+	src := c.PreferredUsername
+	if src == "" {
+		src, _, _ = strings.Cut(c.Email, "@")
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(src) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+		if b.Len() == maxUsernameLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
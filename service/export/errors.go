@@ -0,0 +1,11 @@
+package exportsvc
+
+import "errors"
+
+var (
+	ErrInProgress   = errors.New("export already in progress")
+	ErrNotFound     = errors.New("export not found")
+	ErrNotReady     = errors.New("export is not ready")
+	ErrBadSignature = errors.New("invalid download link")
+	ErrLinkExpired  = errors.New("download link expired")
+)
@@ -0,0 +1,314 @@
+// service/export/exportService.go
+package exportsvc
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"instagram/model"
+	activityrepo "instagram/repository/activity"
+	commentrepo "instagram/repository/comment"
+	exportrepo "instagram/repository/export"
+	likerepo "instagram/repository/like"
+	postrepo "instagram/repository/post"
+	userrepo "instagram/repository/user"
+	jobsvc "instagram/service/job"
+	"instagram/util/logger"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Service interface {
+	// Request queues a takeout archive of everything held about userID.
+	Request(ctx context.Context, userID int64) (*model.DataExport, error)
+	// Status returns the export with a fresh signed download link once it
+	// is ready.
+	Status(ctx context.Context, id, userID int64) (*model.DataExport, error)
+	// Open checks a signed download link and returns the ready export.
+	Open(ctx context.Context, id, expires int64, sig string) (*model.DataExport, error)
+	// HandleBuild is the JobBuild handler.
+	HandleBuild(ctx context.Context, j *model.Job) error
+	// Purge deletes archives past their retention.
+	Purge(ctx context.Context) (int, error)
+}
+
+type Options struct {
+	// Dir is where archives are written.
+	Dir string
+	// Retention is how long a ready archive is kept.
+	Retention time.Duration
+	// LinkTTL is how long a signed download link is valid.
+	LinkTTL time.Duration
+	// Secret signs download links.
+	Secret []byte
+}
+
+// JobBuild is the job kind that builds one export's archive.
+const JobBuild = "data_export.build"
+
+type buildPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+type service struct {
+	er   exportrepo.Repo
+	ur   userrepo.Repo
+	pr   postrepo.Repo
+	lr   likerepo.Repo
+	cr   commentrepo.Repo
+	log  activityrepo.Repo
+	jobs jobsvc.Enqueuer
+	opt  Options
+}
+
+func New(er exportrepo.Repo, ur userrepo.Repo, pr postrepo.Repo, lr likerepo.Repo, cr commentrepo.Repo, log activityrepo.Repo, jobs jobsvc.Enqueuer, opt Options) Service {
+	return &service{er: er, ur: ur, pr: pr, lr: lr, cr: cr, log: log, jobs: jobs, opt: opt}
+}
+
+func (s *service) Request(ctx context.Context, userID int64) (*model.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "exportsvc.Request")
+	defer span.End()
+
+	e, err := s.er.Create(ctx, userID)
+	if errors.Is(err, exportrepo.ErrActive) {
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.jobs.Enqueue(ctx, JobBuild, buildPayload{ExportID: e.ID}); err != nil {
+		// Don't leave a pending export that nothing will build; it would
+		// block the user's next request.
+		_ = s.er.Fail(context.WithoutCancel(ctx), e.ID, "export could not be queued")
+		return nil, fmt.Errorf("enqueue export build: %w", err)
+	}
+	_ = s.log.Log(ctx, model.Activity{
+		UserID:      userID,
+		Action:      model.ActionDataExport,
+		Description: fmt.Sprintf("request DATA_EXPORT id=%d", e.ID),
+		Metadata:    model.ActivityMetadata{TargetType: model.TargetDataExport, TargetID: e.ID},
+	})
+	return e, nil
+}
+
+func (s *service) Status(ctx context.Context, id, userID int64) (*model.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "exportsvc.Status")
+	defer span.End()
+
+	e, err := s.er.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && e.UserID != userID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Status == model.ExportReady {
+		exp := time.Now().Add(s.opt.LinkTTL).Truncate(time.Second)
+		if e.ExpiresAt != nil && exp.After(*e.ExpiresAt) {
+			exp = *e.ExpiresAt
+		}
+		q := url.Values{}
+		q.Set("expires", strconv.FormatInt(exp.Unix(), 10))
+		q.Set("sig", s.sign(e.ID, exp.Unix()))
+		e.DownloadURL = fmt.Sprintf("/v1/exports/%d/download?%s", e.ID, q.Encode())
+		e.URLExpiresAt = &exp
+	}
+	return e, nil
+}
+
+func (s *service) Open(ctx context.Context, id, expires int64, sig string) (*model.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "exportsvc.Open")
+	defer span.End()
+
+	if !hmac.Equal([]byte(sig), []byte(s.sign(id, expires))) {
+		return nil, ErrBadSignature
+	}
+	if time.Now().Unix() > expires {
+		return nil, ErrLinkExpired
+	}
+	e, err := s.er.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != model.ExportReady {
+		return nil, ErrNotReady
+	}
+	if e.ExpiresAt != nil && time.Now().After(*e.ExpiresAt) {
+		// Past retention but not purged yet.
+		return nil, ErrLinkExpired
+	}
+	return e, nil
+}
+
+func (s *service) sign(id, expires int64) string {
+	m := hmac.New(sha256.New, s.opt.Secret)
+	fmt.Fprintf(m, "data-export:%d:%d", id, expires)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func (s *service) HandleBuild(ctx context.Context, j *model.Job) error {
+	ctx, span := tracing.Start(ctx, "exportsvc.HandleBuild")
+	defer span.End()
+
+	var p buildPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return jobsvc.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	e, err := s.er.Start(ctx, p.ExportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Already finished by an earlier attempt, or deleted with its user.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log := logger.From(ctx).With("export_id", e.ID, "user_id", e.UserID)
+
+	path, size, err := s.build(ctx, e)
+	interrupted := jobsvc.Interrupted(ctx)
+	// Record the outcome even when shutdown cancelled the build.
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		if j.LastAttempt() && !interrupted {
+			if err := s.er.Fail(ctx, e.ID, "archive could not be built"); err != nil {
+				log.Error("mark data export failed", "err", err)
+			}
+		}
+		return fmt.Errorf("build data export: %w", err)
+	}
+	if err := s.er.Complete(ctx, e.ID, path, size, time.Now().Add(s.opt.Retention)); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("complete data export: %w", err)
+	}
+	log.Info("data export ready", "bytes", size)
+	return nil
+}
+
+// build writes the archive to a temporary file and renames it into place
+// so a crash never leaves a partial archive behind a ready row.
+func (s *service) build(ctx context.Context, e *model.DataExport) (string, int64, error) {
+	if err := os.MkdirAll(s.opt.Dir, 0o700); err != nil {
+		return "", 0, err
+	}
+	var rnd [8]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(s.opt.Dir, fmt.Sprintf("export-%d-%s.zip", e.ID, hex.EncodeToString(rnd[:])))
+
+	f, err := os.CreateTemp(s.opt.Dir, "export-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := s.writeArchive(ctx, f, e.UserID); err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+func (s *service) writeArchive(ctx context.Context, w io.Writer, userID int64) error {
+	u, err := s.ur.ByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load profile: %w", err)
+	}
+	posts, err := s.pr.AllByAuthor(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load posts: %w", err)
+	}
+	given, err := s.lr.AllByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load likes given: %w", err)
+	}
+	received, err := s.lr.AllOnPostsBy(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load likes received: %w", err)
+	}
+	comments, err := s.cr.AllByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("load comments: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", u},
+		{"posts.json", posts},
+		{"likes_given.json", given},
+		{"likes_received.json", received},
+		{"comments.json", comments},
+	} {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+
+	// Activity history can be long; stream it from the cursor.
+	fw, err := zw.Create("activities.ndjson")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	if err := s.log.Export(ctx, userID, model.ActivityFilter{}, func(a model.Activity) error {
+		return enc.Encode(a)
+	}); err != nil {
+		return fmt.Errorf("write activities: %w", err)
+	}
+	return zw.Close()
+}
+
+func (s *service) Purge(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "exportsvc.Purge")
+	defer span.End()
+
+	paths, err := s.er.ExpireDue(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.From(ctx).Error("remove expired data export failed", "path", p, "err", err)
+		}
+	}
+	return len(paths), nil
+}
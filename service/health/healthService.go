@@ -0,0 +1,138 @@
+package healthsvc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jokerepo "instagram/repository/joke"
+	"instagram/util/database"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// probeTimeout bounds each dependency check so a hung dependency can't
+// stall the probe past the platform's own deadline.
+const probeTimeout = 2 * time.Second
+
+type Check struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	CheckedAt string `json:"checked_at"`
+}
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+	Pool   database.Stats   `json:"pool"`
+}
+
+type Service interface {
+	// Ready checks every dependency. Report.Status is "down" when a
+	// critical dependency fails and "degraded" when only optional ones do.
+	Ready(ctx context.Context) Report
+	// Drain makes every later Ready report "down" so load balancers stop
+	// routing here while in-flight requests finish.
+	Drain()
+}
+
+type service struct {
+	db  *database.DB
+	jr  jokerepo.Repo
+	ttl time.Duration
+
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	joke   Check
+	jokeAt time.Time
+	probe  singleflight.Group
+}
+
+func New(db *database.DB, jr jokerepo.Repo, upstreamTTL time.Duration) Service {
+	return &service{db: db, jr: jr, ttl: upstreamTTL}
+}
+
+func (s *service) Drain() { s.draining.Store(true) }
+
+func (s *service) Ready(ctx context.Context) Report {
+	if s.draining.Load() {
+		return Report{
+			Status: StatusDown,
+			Checks: map[string]Check{
+				"shutdown": {Status: StatusDown, Critical: true, Error: "server is draining"},
+			},
+			Pool: s.db.Stats(),
+		}
+	}
+
+	rep := Report{
+		Status: StatusUp,
+		Checks: map[string]Check{
+			"database": run(ctx, true, s.db.Ping),
+			"joke_api": s.jokeCheck(ctx),
+		},
+		Pool: s.db.Stats(),
+	}
+	for _, c := range rep.Checks {
+		if c.Status == StatusUp {
+			continue
+		}
+		if c.Critical {
+			rep.Status = StatusDown
+			break
+		}
+		rep.Status = StatusDegraded
+	}
+	return rep
+}
+
+// jokeCheck reuses the last upstream result for ttl; the joke API is
+// optional (posts still get created without a joke). Concurrent probes
+// after expiry share one upstream request, made without holding mu.
+func (s *service) jokeCheck(ctx context.Context) Check {
+	s.mu.Lock()
+	if !s.jokeAt.IsZero() && time.Since(s.jokeAt) < s.ttl {
+		c := s.joke
+		s.mu.Unlock()
+		return c
+	}
+	s.mu.Unlock()
+
+	v, _, _ := s.probe.Do("joke_api", func() (any, error) {
+		c := run(ctx, false, s.jr.Ping)
+		s.mu.Lock()
+		s.joke, s.jokeAt = c, time.Now()
+		s.mu.Unlock()
+		return c, nil
+	})
+	return v.(Check)
+}
+
+func run(ctx context.Context, critical bool, ping func(context.Context) error) Check {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ping(ctx)
+	c := Check{
+		Status:    StatusUp,
+		Critical:  critical,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		c.Status = StatusDown
+		c.Error = err.Error()
+	}
+	return c
+}
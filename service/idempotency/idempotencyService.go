@@ -0,0 +1,66 @@
+package idempotencysvc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"instagram/model"
+	idempotencyrepo "instagram/repository/idempotency"
+)
+
+var (
+	ErrInFlight  = errors.New("a request with this idempotency key is still in progress")
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+type Service interface {
+	// Begin returns the stored response to replay when it is Completed,
+	// otherwise the caller's claim on the key: it should execute the
+	// request and pass the claim to Finish. ErrInFlight and ErrKeyReused
+	// report a concurrent duplicate and a key reused with another payload.
+	Begin(ctx context.Context, userID int64, key, requestHash string) (*model.IdempotencyRecord, error)
+	// Finish stores the response for replay. Server errors release the key
+	// instead, so the client's retry runs the request again.
+	Finish(ctx context.Context, claim *model.IdempotencyRecord, status int, contentType string, body []byte) error
+	Purge(ctx context.Context) (int64, error)
+}
+
+type service struct {
+	r          idempotencyrepo.Repo
+	ttl        time.Duration
+	staleAfter time.Duration
+}
+
+func New(r idempotencyrepo.Repo, ttl, staleAfter time.Duration) Service {
+	return &service{r: r, ttl: ttl, staleAfter: staleAfter}
+}
+
+func (s *service) Begin(ctx context.Context, userID int64, key, requestHash string) (*model.IdempotencyRecord, error) {
+	rec, claimed, err := s.r.Claim(ctx, userID, key, requestHash, s.ttl, s.staleAfter)
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		return rec, nil
+	}
+	if rec.RequestHash != requestHash {
+		return nil, ErrKeyReused
+	}
+	if !rec.Completed() {
+		return nil, ErrInFlight
+	}
+	return rec, nil
+}
+
+func (s *service) Finish(ctx context.Context, claim *model.IdempotencyRecord, status int, contentType string, body []byte) error {
+	if status >= http.StatusInternalServerError {
+		return s.r.Release(ctx, claim)
+	}
+	return s.r.Complete(ctx, claim, status, contentType, body)
+}
+
+func (s *service) Purge(ctx context.Context) (int64, error) {
+	return s.r.PurgeExpired(ctx)
+}
@@ -0,0 +1,25 @@
+package jobsvc
+
+import "errors"
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrNotDead     = errors.New("only dead jobs can be retried")
+	ErrUnknownKind = errors.New("no handler registered for job kind")
+)
+
+// permanent marks a handler error that retrying can't fix.
+type permanent struct{ err error }
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent wraps err so the job is dead-lettered without further
+// attempts.
+func Permanent(err error) error { return permanent{err} }
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var p permanent
+	return errors.As(err, &p)
+}
@@ -0,0 +1,400 @@
+// service/job/jobService.go
+package jobsvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"instagram/model"
+	jobrepo "instagram/repository/job"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robfig/cron/v3"
+)
+
+// Handler runs one attempt of a job. Returning an error retries the job
+// with backoff until it runs out of attempts; wrap it with Permanent to
+// give up at once. An attempt cut short by shutdown is requeued and does
+// not count.
+type Handler func(ctx context.Context, j *model.Job) error
+
+// Interrupted reports whether a handler's ctx was cancelled by shutdown,
+// as opposed to running out of time. Handlers that act on LastAttempt
+// should not when interrupted: the attempt will be given back.
+func Interrupted(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// Enqueuer is the part of Service producers need.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, payload any, opts ...EnqueueOption) (*model.Job, error)
+}
+
+type Service interface {
+	Enqueuer
+	// Register and Schedule must be called before Run.
+	Register(kind string, h Handler)
+	// Schedule enqueues kind on a cron spec ("0 3 * * *", "@hourly",
+	// "@every 1h"). Every instance may schedule; each run is enqueued once.
+	Schedule(spec, kind string) error
+	// Run works the queue with the configured concurrency until ctx is
+	// done and every running attempt has returned.
+	Run(ctx context.Context)
+
+	List(ctx context.Context, f model.JobFilter) (*model.JobPage, error)
+	Detail(ctx context.Context, id int64) (*model.Job, error)
+	// Retry makes a dead job runnable again with fresh attempts.
+	Retry(ctx context.Context, id int64) (*model.Job, error)
+	// Purge deletes done jobs older than the retention.
+	Purge(ctx context.Context) (int64, error)
+}
+
+type Options struct {
+	Concurrency  int
+	PollInterval time.Duration
+	// LockTimeout bounds one attempt; a job held longer is presumed
+	// abandoned and claimed again.
+	LockTimeout time.Duration
+	Retention   time.Duration
+	MaxAttempts int
+	// Retries wait BaseBackoff * 2^(attempt-1), at most MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+type EnqueueOption func(*model.Job)
+
+// RunAt delays the job until t.
+func RunAt(t time.Time) EnqueueOption { return func(j *model.Job) { j.RunAt = t } }
+
+// MaxAttempts overrides the default attempt budget.
+func MaxAttempts(n int) EnqueueOption { return func(j *model.Job) { j.MaxAttempts = n } }
+
+// UniqueKey makes Enqueue a no-op while a job with the same key exists.
+func UniqueKey(k string) EnqueueOption { return func(j *model.Job) { j.UniqueKey = k } }
+
+const (
+	defaultPageSize = 50
+	// scheduleEvery is how often schedules enqueue their next run.
+	scheduleEvery = 30 * time.Second
+)
+
+type schedule struct {
+	spec  string
+	kind  string
+	sched cron.Schedule
+}
+
+type service struct {
+	jr  jobrepo.Repo
+	opt Options
+
+	mu        sync.RWMutex
+	handlers  map[string]Handler
+	schedules []schedule
+
+	wake chan struct{}
+}
+
+func New(jr jobrepo.Repo, opt Options) Service {
+	if opt.Concurrency < 1 {
+		opt.Concurrency = 1
+	}
+	if opt.MaxAttempts < 1 {
+		opt.MaxAttempts = 5
+	}
+	if opt.BaseBackoff <= 0 {
+		opt.BaseBackoff = 10 * time.Second
+	}
+	if opt.MaxBackoff <= 0 {
+		opt.MaxBackoff = time.Hour
+	}
+	return &service{jr: jr, opt: opt, handlers: map[string]Handler{}, wake: make(chan struct{}, 1)}
+}
+
+func (s *service) Register(kind string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[kind] = h
+}
+
+func (s *service) Schedule(spec, kind string) error {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("schedule %s: %w", kind, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules = append(s.schedules, schedule{spec: spec, kind: kind, sched: sched})
+	return nil
+}
+
+func (s *service) Enqueue(ctx context.Context, kind string, payload any, opts ...EnqueueOption) (*model.Job, error) {
+	ctx, span := tracing.Start(ctx, "jobsvc.Enqueue")
+	defer span.End()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s payload: %w", kind, err)
+	}
+	if payload == nil {
+		raw = nil
+	}
+	j := &model.Job{Kind: kind, Payload: raw, MaxAttempts: s.opt.MaxAttempts, RunAt: time.Now()}
+	for _, o := range opts {
+		o(j)
+	}
+	created, err := s.jr.Enqueue(ctx, j)
+	if err != nil {
+		return nil, err
+	}
+	if created && !j.RunAt.After(time.Now()) {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return j, nil
+}
+
+func (s *service) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.scheduleLoop(ctx)
+	}()
+	for i := 0; i < s.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.workLoop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *service) workLoop(ctx context.Context) {
+	t := time.NewTicker(s.opt.PollInterval)
+	defer t.Stop()
+	for {
+		// Keep going while there is work; only sleep on an empty queue.
+		for ctx.Err() == nil && s.runOne(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// runOne claims and runs a single job, reporting whether it found one.
+func (s *service) runOne(ctx context.Context) bool {
+	jobs, err := s.jr.Claim(ctx, s.kinds(), 1, s.opt.LockTimeout)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.From(ctx).Error("claim job failed", "err", err)
+		}
+		return false
+	}
+	if len(jobs) == 0 {
+		return false
+	}
+	s.execute(ctx, &jobs[0])
+	return true
+}
+
+func (s *service) kinds() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kinds := make([]string, 0, len(s.handlers))
+	for k := range s.handlers {
+		kinds = append(kinds, k)
+	}
+	return kinds
+}
+
+func (s *service) execute(ctx context.Context, j *model.Job) {
+	ctx, span := tracing.Start(ctx, "job "+j.Kind)
+	defer span.End()
+	log := logger.From(ctx).With("job_id", j.ID, "kind", j.Kind, "attempt", j.Attempts)
+	ctx = logger.With(ctx, log)
+
+	s.mu.RLock()
+	h := s.handlers[j.Kind]
+	s.mu.RUnlock()
+
+	start := time.Now()
+	err := s.call(ctx, h, j)
+	metrics.JobDuration.WithLabelValues(j.Kind).Observe(time.Since(start).Seconds())
+
+	// Settle even when shutdown cancelled the attempt.
+	interrupted := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+	var settled bool
+	var outcome string
+	switch {
+	case err == nil:
+		outcome = "done"
+		settled, err = s.jr.Complete(ctx, j)
+	case interrupted:
+		outcome = "interrupted"
+		log.Info("job interrupted by shutdown, requeueing", "err", err)
+		settled, err = s.jr.Release(ctx, j)
+	case IsPermanent(err) || j.LastAttempt():
+		tracing.Fail(span, err)
+		outcome = "dead"
+		log.Error("job dead-lettered", "err", err)
+		settled, err = s.jr.Bury(ctx, j, err.Error())
+	default:
+		tracing.Fail(span, err)
+		outcome = "retry"
+		delay := s.backoff(j.Attempts)
+		log.Warn("job failed, retrying", "err", err, "retry_in", delay)
+		settled, err = s.jr.Retry(ctx, j, time.Now().Add(delay), err.Error())
+	}
+	metrics.JobRuns.WithLabelValues(j.Kind, outcome).Inc()
+	if err != nil {
+		log.Error("settle job failed", "err", err)
+	} else if !settled {
+		log.Warn("job lock expired before it finished; another worker reclaimed it")
+	}
+}
+
+// call runs h under the lock timeout and turns a panic into an error.
+func (s *service) call(ctx context.Context, h Handler, j *model.Job) (err error) {
+	if h == nil {
+		return Permanent(ErrUnknownKind)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.opt.LockTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, j)
+}
+
+// backoff is the exponential delay before the next attempt, with up to
+// 20% jitter so failures in a batch don't retry in lockstep.
+func (s *service) backoff(attempt int) time.Duration {
+	d := s.opt.BaseBackoff
+	for i := 1; i < attempt && d < s.opt.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, s.opt.MaxBackoff)
+	return d + time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+func (s *service) scheduleLoop(ctx context.Context) {
+	t := time.NewTicker(scheduleEvery)
+	defer t.Stop()
+	for {
+		s.enqueueScheduled(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// enqueueScheduled makes sure each schedule's next run is queued. The
+// unique key is derived from the run time, so repeated calls and other
+// instances don't duplicate it.
+func (s *service) enqueueScheduled(ctx context.Context) {
+	s.mu.RLock()
+	schedules := s.schedules
+	s.mu.RUnlock()
+
+	now := time.Now()
+	for _, sc := range schedules {
+		next := nextRun(sc.sched, now)
+		key := fmt.Sprintf("cron:%s:%d", sc.kind, next.Unix())
+		if _, err := s.Enqueue(ctx, sc.kind, nil, RunAt(next), UniqueKey(key)); err != nil && ctx.Err() == nil {
+			logger.From(ctx).Error("enqueue scheduled job failed", "kind", sc.kind, "spec", sc.spec, "err", err)
+		}
+	}
+}
+
+// nextRun is sched's next activation after now. "@every" schedules are
+// counted from the Unix epoch rather than from now, so that all instances
+// agree on the slot.
+func nextRun(sched cron.Schedule, now time.Time) time.Time {
+	if every, ok := sched.(cron.ConstantDelaySchedule); ok {
+		return now.Truncate(every.Delay).Add(every.Delay)
+	}
+	return sched.Next(now)
+}
+
+func (s *service) List(ctx context.Context, f model.JobFilter) (*model.JobPage, error) {
+	ctx, span := tracing.Start(ctx, "jobsvc.List")
+	defer span.End()
+
+	if f.Limit == 0 {
+		f.Limit = defaultPageSize
+	}
+	limit := f.Limit
+	f.Limit++
+	jobs, err := s.jr.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.JobPage{Items: jobs}
+	if len(jobs) > limit {
+		page.Items = jobs[:limit]
+		next := page.Items[limit-1].ID
+		page.NextBeforeID = &next
+	}
+	return page, nil
+}
+
+func (s *service) Detail(ctx context.Context, id int64) (*model.Job, error) {
+	ctx, span := tracing.Start(ctx, "jobsvc.Detail")
+	defer span.End()
+
+	j, err := s.jr.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return j, err
+}
+
+func (s *service) Retry(ctx context.Context, id int64) (*model.Job, error) {
+	ctx, span := tracing.Start(ctx, "jobsvc.Retry")
+	defer span.End()
+
+	j, err := s.jr.Requeue(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := s.Detail(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotDead
+	}
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return j, nil
+}
+
+func (s *service) Purge(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "jobsvc.Purge")
+	defer span.End()
+
+	return s.jr.PurgeFinished(ctx, time.Now().Add(-s.opt.Retention))
+}
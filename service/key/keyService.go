@@ -0,0 +1,181 @@
+// service/key/keyService.go
+package keysvc
+
+import (
+	"context"
+	"crypto"
+	"time"
+
+	"instagram/model"
+	keyrepo "instagram/repository/key"
+	jwtutil "instagram/util/jwt"
+	"instagram/util/logger"
+	"instagram/util/secretbox"
+	"instagram/util/tracing"
+)
+
+// JobRotate is the scheduled job that rotates signing keys.
+const JobRotate = "jwt.rotate_keys"
+
+const (
+	// publishAhead is how long a new key is in the JWKS before it signs,
+	// so every instance has loaded it and verifiers caching the JWKS have
+	// refetched it by the time tokens name it.
+	publishAhead = time.Hour
+	// refreshInterval is how often each instance reloads the keys.
+	refreshInterval = time.Minute
+)
+
+type Service interface {
+	// Load creates the first key if there is none and loads the key set.
+	// Call it before serving.
+	Load(ctx context.Context) error
+	// Run reloads the key set every minute until ctx ends, picking up keys
+	// rotated by other instances.
+	Run(ctx context.Context)
+	// Rotate publishes the next key once the signing key is due, or the
+	// configured algorithm changed, and deletes retired keys.
+	Rotate(ctx context.Context) error
+	// JWKS is the public half of every loaded key.
+	JWKS() jwtutil.JWKS
+}
+
+type Options struct {
+	// Rotation is how long a key signs before the next one takes over.
+	Rotation time.Duration
+	// TokenTTL is the lifetime of issued tokens, which retired keys must
+	// keep verifying for.
+	TokenTTL time.Duration
+	// Secret seals private keys at rest.
+	Secret []byte
+}
+
+type service struct {
+	r   keyrepo.Repo
+	ks  *jwtutil.KeySet
+	opt Options
+	// box seals private keys at rest.
+	box *secretbox.Box
+}
+
+func New(r keyrepo.Repo, ks *jwtutil.KeySet, opt Options) Service {
+	return &service{r: r, ks: ks, opt: opt, box: secretbox.New(opt.Secret, "jwt-signing-keys")}
+}
+
+func (s *service) Load(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "keysvc.Load")
+	defer span.End()
+
+	if s.ks.Alg() != jwtutil.HS256 {
+		k, err := s.generate(time.Now())
+		if err != nil {
+			return err
+		}
+		created, err := s.r.CreateFirst(ctx, k)
+		if err != nil {
+			return err
+		}
+		if created {
+			logger.From(ctx).Info("created first jwt signing key", "kid", k.KID, "alg", k.Alg)
+		}
+	}
+	return s.reload(ctx)
+}
+
+func (s *service) Run(ctx context.Context) {
+	t := time.NewTicker(refreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := s.reload(ctx); err != nil && ctx.Err() == nil {
+			// Keep verifying with the keys already loaded.
+			logger.From(ctx).Error("reload jwt signing keys failed", "err", err)
+		}
+	}
+}
+
+func (s *service) Rotate(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "keysvc.Rotate")
+	defer span.End()
+
+	keys, err := s.r.All(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	alg := s.ks.Alg()
+	if alg != jwtutil.HS256 {
+		// The newest key is the signing key, or the next one if published
+		// and not active yet; either way nothing is due until it ages.
+		var newest *model.SigningKey
+		if len(keys) > 0 {
+			newest = &keys[len(keys)-1]
+		}
+		if newest == nil || newest.Alg != alg || now.Sub(newest.ActivatesAt) >= s.opt.Rotation-publishAhead {
+			activates := now.Add(publishAhead)
+			if newest == nil {
+				activates = now
+			}
+			k, err := s.generate(activates)
+			if err != nil {
+				return err
+			}
+			if err := s.r.Create(ctx, k); err != nil {
+				return err
+			}
+			logger.From(ctx).Info("published jwt signing key", "kid", k.KID, "alg", k.Alg, "activates_at", k.ActivatesAt)
+		}
+	}
+
+	n, err := s.r.PurgeRetired(ctx, s.opt.TokenTTL)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logger.From(ctx).Info("deleted retired jwt signing keys", "count", n)
+	}
+	return s.reload(ctx)
+}
+
+func (s *service) JWKS() jwtutil.JWKS { return s.ks.JWKS() }
+
+// generate creates a sealed key of the configured algorithm.
+func (s *service) generate(activatesAt time.Time) (*model.SigningKey, error) {
+	k, err := jwtutil.GenerateKey(s.ks.Alg(), activatesAt)
+	if err != nil {
+		return nil, err
+	}
+	der, err := k.MarshalPrivate()
+	if err != nil {
+		return nil, err
+	}
+	return &model.SigningKey{KID: k.ID, Alg: k.Alg, PrivateKey: s.box.Seal(der, []byte(k.ID)), ActivatesAt: activatesAt}, nil
+}
+
+// reload replaces the key set with the stored keys. A key that can't be
+// opened, e.g. after JWT_KEY_SECRET changed, is skipped and logged
+// rather than failing the rest.
+func (s *service) reload(ctx context.Context) error {
+	stored, err := s.r.All(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]jwtutil.Key, 0, len(stored))
+	for _, sk := range stored {
+		der, err := s.box.Open(sk.PrivateKey, []byte(sk.KID))
+		if err == nil {
+			var priv crypto.Signer
+			if priv, err = jwtutil.ParsePrivate(der); err == nil {
+				keys = append(keys, jwtutil.Key{ID: sk.KID, Alg: sk.Alg, Private: priv, ActivatesAt: sk.ActivatesAt})
+				continue
+			}
+		}
+		logger.From(ctx).Error("unusable jwt signing key", "kid", sk.KID, "err", err)
+	}
+	s.ks.Replace(keys)
+	return nil
+}
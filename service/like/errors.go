@@ -0,0 +1,11 @@
+// service/like/errors.go
+package likesvc
+
+import "errors"
+
+var (
+	ErrAlreadyLiked = errors.New("post already liked")
+	ErrPostNotFound = errors.New("post not found")
+	ErrNotFound     = errors.New("like not found")
+	ErrNotOwner     = errors.New("not owner")
+)
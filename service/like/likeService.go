@@ -9,46 +9,180 @@ import (
 	activityrepo "instagram/repository/activity"
 	likerepo "instagram/repository/like"
 	postrepo "instagram/repository/post"
+	webhooksvc "instagram/service/webhook"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type Service interface {
 	Create(ctx context.Context, userID int64, req model.CreateLikeReq) (*model.Like, error)
+	// Like is the idempotent form of Create: liking twice is not an error
+	// and created reports whether this call added the like.
+	Like(ctx context.Context, userID, postID int64) (lk *model.Like, created bool, err error)
+	// Unlike removes the user's like on postID if there is one.
+	Unlike(ctx context.Context, userID, postID int64) error
 	Detail(ctx context.Context, id int64) (*model.Like, error)
 	Delete(ctx context.Context, id, userID int64) error
 }
 
 type service struct {
-	lr  likerepo.Repo
-	pr  postrepo.Repo
-	log activityrepo.Repo
+	lr     likerepo.Repo
+	pr     postrepo.Repo
+	log    activityrepo.Repo
+	events webhooksvc.Publisher
 }
 
-func New(lr likerepo.Repo, pr postrepo.Repo, log activityrepo.Repo) Service {
-	return &service{lr, pr, log}
+func New(lr likerepo.Repo, pr postrepo.Repo, log activityrepo.Repo, events webhooksvc.Publisher) Service {
+	return &service{lr, pr, log, events}
 }
 
 func (s *service) Create(ctx context.Context, userID int64, req model.CreateLikeReq) (*model.Like, error) {
-	if _, err := s.pr.ByID(ctx, req.PostID); err != nil {
-		return nil, errors.New("post not found")
+	ctx, span := tracing.Start(ctx, "likesvc.Create")
+	defer span.End()
+
+	p, err := s.post(ctx, req.PostID)
+	if err != nil {
+		return nil, err
 	}
 	lk, err := s.lr.Create(ctx, userID, req.PostID)
 	if err != nil {
+		if errors.Is(err, likerepo.ErrDuplicate) {
+			return nil, ErrAlreadyLiked
+		}
 		return nil, err
 	}
-	_ = s.log.Log(ctx, model.Activity{UserID: userID, Action: "LIKE_CREATE", Description: fmt.Sprintf("like POST id=%d", req.PostID)})
+	s.liked(ctx, userID, p)
 	return lk, nil
 }
+
+func (s *service) Like(ctx context.Context, userID, postID int64) (*model.Like, bool, error) {
+	ctx, span := tracing.Start(ctx, "likesvc.Like")
+	defer span.End()
+
+	p, err := s.post(ctx, postID)
+	if err != nil {
+		return nil, false, err
+	}
+	lk, created, err := s.lr.Upsert(ctx, userID, postID)
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		s.liked(ctx, userID, p)
+	}
+	return lk, created, nil
+}
+
+func (s *service) Unlike(ctx context.Context, userID, postID int64) error {
+	ctx, span := tracing.Start(ctx, "likesvc.Unlike")
+	defer span.End()
+
+	p, err := s.post(ctx, postID)
+	if err != nil {
+		return err
+	}
+	ok, err := s.lr.DeleteByPostUser(ctx, postID, userID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		s.unliked(ctx, userID, p)
+	}
+	return nil
+}
+
 func (s *service) Detail(ctx context.Context, id int64) (*model.Like, error) {
-	return s.lr.ByID(ctx, id)
+	ctx, span := tracing.Start(ctx, "likesvc.Detail")
+	defer span.End()
+
+	lk, err := s.lr.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return lk, err
 }
+
 func (s *service) Delete(ctx context.Context, id, userID int64) error {
+	ctx, span := tracing.Start(ctx, "likesvc.Delete")
+	defer span.End()
+
+	lk, err := s.lr.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if lk.UserID != userID {
+		return ErrNotOwner
+	}
+
 	ok, err := s.lr.DeleteByIDOwner(ctx, id, userID)
 	if err != nil {
 		return err
 	}
 	if !ok {
-		return errors.New("not allowed or like not found")
+		// Removed concurrently between the lookup and the delete.
+		return ErrNotFound
 	}
-	_ = s.log.Log(ctx, model.Activity{UserID: userID, Action: "LIKE_DELETE", Description: fmt.Sprintf("unlike like_id=%d", id)})
+	p, err := s.pr.ByID(ctx, lk.PostID)
+	if err != nil {
+		// The post itself is gone; its author has nothing to be told.
+		p = &model.Post{ID: lk.PostID}
+	}
+	s.unliked(ctx, userID, p)
 	return nil
 }
+
+func (s *service) post(ctx context.Context, postID int64) (*model.Post, error) {
+	p, err := s.pr.ByID(ctx, postID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	return p, err
+}
+
+// invalidate drops postID from the repo cache, if there is one, since
+// its like_count just changed.
+func (s *service) invalidate(postID int64) {
+	if c, ok := s.pr.(postrepo.Invalidator); ok {
+		c.Invalidate(postID)
+	}
+}
+
+func (s *service) liked(ctx context.Context, userID int64, p *model.Post) {
+	s.invalidate(p.ID)
+	metrics.LikesCreated.Inc()
+	_ = s.log.Log(ctx, model.Activity{
+		UserID:      userID,
+		Action:      model.ActionLikeCreate,
+		Description: fmt.Sprintf("like POST id=%d", p.ID),
+		Metadata:    model.ActivityMetadata{TargetType: model.TargetPost, TargetID: p.ID},
+	})
+	s.publish(ctx, model.EventLikeCreated, userID, p)
+}
+
+func (s *service) unliked(ctx context.Context, userID int64, p *model.Post) {
+	s.invalidate(p.ID)
+	metrics.LikesDeleted.Inc()
+	_ = s.log.Log(ctx, model.Activity{
+		UserID:      userID,
+		Action:      model.ActionLikeDelete,
+		Description: fmt.Sprintf("unlike POST id=%d", p.ID),
+		Metadata:    model.ActivityMetadata{TargetType: model.TargetPost, TargetID: p.ID},
+	})
+	s.publish(ctx, model.EventLikeDeleted, userID, p)
+}
+
+// publish sends a like event to the liker's and the post author's
+// webhooks.
+func (s *service) publish(ctx context.Context, event string, userID int64, p *model.Post) {
+	data := map[string]int64{"post_id": p.ID, "user_id": userID}
+	if p.AuthorID == 0 || p.AuthorID == userID {
+		s.events.Publish(ctx, event, data, userID)
+		return
+	}
+	s.events.Publish(ctx, event, data, userID, p.AuthorID)
+}
@@ -0,0 +1,12 @@
+package mfasvc
+
+import "errors"
+
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled    = errors.New("two-factor authentication setup has not been started")
+	ErrNotEnabled     = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidCode covers wrong, expired and already used codes.
+	ErrInvalidCode = errors.New("invalid code")
+	ErrLocked      = errors.New("too many wrong codes; try again later")
+)
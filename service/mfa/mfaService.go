@@ -0,0 +1,292 @@
+// service/mfa/mfaService.go
+package mfasvc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"instagram/model"
+	mfarepo "instagram/repository/mfa"
+	userrepo "instagram/repository/user"
+	"instagram/util/secretbox"
+	"instagram/util/totp"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// skew accepts codes one step either side of now.
+	skew = 1
+	// maxAttempts wrong codes in a row lock 2FA checks for lockFor, which
+	// keeps guessing 6-digit codes impractical.
+	maxAttempts = 5
+	lockFor     = 15 * time.Minute
+
+	recoveryCodeCount = 10
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type Service interface {
+	Status(ctx context.Context, userID int64) (*model.MFAStatus, error)
+	// Enroll starts, or restarts, setting up an authenticator app. 2FA is
+	// off until Confirm.
+	Enroll(ctx context.Context, userID int64) (*model.TOTPEnrollment, error)
+	// Confirm turns 2FA on once the app produces a valid code, and
+	// returns the recovery codes, which are not stored in clear.
+	Confirm(ctx context.Context, userID int64, code string) ([]string, error)
+	// Disable turns 2FA off; code may be an authenticator or recovery code.
+	Disable(ctx context.Context, userID int64, code string) error
+	// RegenerateRecoveryCodes replaces the recovery codes.
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error)
+
+	// Enabled reports whether logins for userID need a second factor.
+	Enabled(ctx context.Context, userID int64) (bool, error)
+	// Verify checks an authenticator or recovery code. Each code is
+	// accepted once.
+	Verify(ctx context.Context, userID int64, code string) error
+}
+
+type Options struct {
+	// Issuer names the account in authenticator apps.
+	Issuer string
+	// Secret seals TOTP seeds at rest.
+	Secret []byte
+}
+
+type service struct {
+	r   mfarepo.Repo
+	ur  userrepo.Repo
+	opt Options
+	box *secretbox.Box
+}
+
+func New(r mfarepo.Repo, ur userrepo.Repo, opt Options) Service {
+	return &service{r: r, ur: ur, opt: opt, box: secretbox.New(opt.Secret, "totp")}
+}
+
+func (s *service) Status(ctx context.Context, userID int64) (*model.MFAStatus, error) {
+	ctx, span := tracing.Start(ctx, "mfasvc.Status")
+	defer span.End()
+
+	t, err := s.r.ByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && t.EnabledAt == nil) {
+		return &model.MFAStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.r.RecoveryCodesRemaining(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.MFAStatus{Enabled: true, EnabledAt: t.EnabledAt, RecoveryCodesRemaining: n}, nil
+}
+
+func (s *service) Enroll(ctx context.Context, userID int64) (*model.TOTPEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "mfasvc.Enroll")
+	defer span.End()
+
+	u, err := s.ur.ByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.r.SaveSecret(ctx, userID, s.box.Seal(secret, ad(userID)))
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrAlreadyEnabled
+	}
+	return &model.TOTPEnrollment{
+		Secret: totp.Encode(secret),
+		URI:    totp.URI(s.opt.Issuer, u.Username, secret),
+	}, nil
+}
+
+func (s *service) Confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "mfasvc.Confirm")
+	defer span.End()
+
+	t, err := s.r.ByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.EnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+	if locked(t) {
+		return nil, ErrLocked
+	}
+	secret, err := s.box.Open(t.Secret, ad(userID))
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Match(secret, normalize(code), time.Now(), skew)
+	if !ok {
+		return nil, s.fail(ctx, userID)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.r.Enable(ctx, userID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		// Confirmed concurrently, or the code was already used.
+		return nil, ErrInvalidCode
+	}
+	return codes, nil
+}
+
+func (s *service) Disable(ctx context.Context, userID int64, code string) error {
+	ctx, span := tracing.Start(ctx, "mfasvc.Disable")
+	defer span.End()
+
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	_, err := s.r.Delete(ctx, userID)
+	return err
+}
+
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, userID int64, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "mfasvc.RegenerateRecoveryCodes")
+	defer span.End()
+
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.r.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *service) Enabled(ctx context.Context, userID int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "mfasvc.Enabled")
+	defer span.End()
+
+	t, err := s.r.ByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.EnabledAt != nil, nil
+}
+
+func (s *service) Verify(ctx context.Context, userID int64, code string) error {
+	ctx, span := tracing.Start(ctx, "mfasvc.Verify")
+	defer span.End()
+
+	t, err := s.r.ByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if t.EnabledAt == nil {
+		return ErrNotEnabled
+	}
+	if locked(t) {
+		return ErrLocked
+	}
+
+	code = normalize(code)
+	var used bool
+	if isTOTP(code) {
+		secret, err := s.box.Open(t.Secret, ad(userID))
+		if err != nil {
+			return err
+		}
+		if step, ok := totp.Match(secret, code, time.Now(), skew); ok {
+			// False for a replayed code, which counts as wrong.
+			if used, err = s.r.UseStep(ctx, userID, step); err != nil {
+				return err
+			}
+		}
+	} else if used, err = s.r.UseRecoveryCode(ctx, userID, hashCode(code)); err != nil {
+		return err
+	}
+	if !used {
+		return s.fail(ctx, userID)
+	}
+	return nil
+}
+
+// fail records a wrong code and returns ErrInvalidCode.
+func (s *service) fail(ctx context.Context, userID int64) error {
+	if err := s.r.RecordFailure(ctx, userID, maxAttempts, lockFor); err != nil {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+func locked(t *model.TOTP) bool {
+	return t.LockedUntil != nil && time.Now().Before(*t.LockedUntil)
+}
+
+// ad binds a sealed seed to its user.
+func ad(userID int64) []byte { return []byte(strconv.FormatInt(userID, 10)) }
+
+// normalize drops the separators users copy along with codes.
+func normalize(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+func isTOTP(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns codes formatted for display and their hashes.
+// Each carries 80 random bits, so a fast hash is enough.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b [10]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(recoveryEncoding.EncodeToString(b[:]))
+		codes = append(codes, c[0:4]+"-"+c[4:8]+"-"+c[8:12]+"-"+c[12:16])
+		hashes = append(hashes, hashCode(c))
+	}
+	return codes, hashes, nil
+}
+
+func hashCode(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,4 +7,7 @@ var (
 	ErrBadInput = errors.New("bad input")
 	ErrNotOwner = errors.New("not owner")
 	ErrNotFound = errors.New("post not found")
+
+	ErrNotDeleted     = errors.New("post is not deleted")
+	ErrRestoreExpired = errors.New("restore window has passed")
 )
@@ -3,35 +3,77 @@ package postsvc
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log/slog"
+	"strings"
+	"time"
 
 	"instagram/model"
 	activityrepo "instagram/repository/activity"
+	commentrepo "instagram/repository/comment"
 	jokerrepo "instagram/repository/joke"
 	likerepo "instagram/repository/like"
 	postrepo "instagram/repository/post"
+	userrepo "instagram/repository/user"
+	webhooksvc "instagram/service/webhook"
+	"instagram/util/loader"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultLikersLimit   = 20
+	defaultCommentsLimit = 20
+	// recentLikersLimit is how many likers each post in a list carries.
+	recentLikersLimit = 3
+)
+
+// Loader names in the request scope.
+type (
+	usersLoader        struct{}
+	recentLikersLoader struct{}
 )
 
 type Service interface {
 	Create(ctx context.Context, userID int64, req model.CreatePostReq) (*model.Post, error)
-	List(ctx context.Context) ([]model.Post, error)
-	Detail(ctx context.Context, id int64) (map[string]any, error)
+	// List and Detail set LikedByMe from viewerID's likes.
+	List(ctx context.Context, viewerID int64) ([]model.Post, error)
+	Detail(ctx context.Context, id, viewerID int64, q model.DetailQuery) (*model.PostDetail, error)
+	// AddComment comments on a live post as userID.
+	AddComment(ctx context.Context, postID, userID int64, req model.CreateCommentReq) (*model.Comment, error)
+	// Delete soft-deletes; Restore undoes it within the restore window.
 	Delete(ctx context.Context, id, userID int64) error
+	Restore(ctx context.Context, id, userID int64) (*model.Post, error)
+	// PurgeDeleted hard-deletes posts and likes soft-deleted more than
+	// olderThan ago.
+	PurgeDeleted(ctx context.Context, olderThan time.Duration) (posts, likes int64, err error)
+	// ReconcileLikeCounts repairs drifted posts.like_count values.
+	ReconcileLikeCounts(ctx context.Context) (int64, error)
 }
 
 type service struct {
 	pr       postrepo.Repo
 	lr       likerepo.Repo
+	cr       commentrepo.Repo
+	ur       userrepo.Repo
 	log      activityrepo.Repo
 	jokeRepo jokerrepo.Repo
+	events   webhooksvc.Publisher
+
+	restoreWindow time.Duration
 }
 
-func New(pr postrepo.Repo, lr likerepo.Repo, log activityrepo.Repo, jr jokerrepo.Repo) Service {
-	return &service{pr: pr, lr: lr, log: log, jokeRepo: jr}
+func New(pr postrepo.Repo, lr likerepo.Repo, cr commentrepo.Repo, ur userrepo.Repo, log activityrepo.Repo, jr jokerrepo.Repo, events webhooksvc.Publisher, restoreWindow time.Duration) Service {
+	return &service{pr: pr, lr: lr, cr: cr, ur: ur, log: log, jokeRepo: jr, events: events, restoreWindow: restoreWindow}
 }
 
 func (s *service) Create(ctx context.Context, userID int64, req model.CreatePostReq) (*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.Create")
+	defer span.End()
+
 	if req.Title == "" {
 		return nil, ErrBadInput
 	}
@@ -49,7 +91,7 @@ func (s *service) Create(ctx context.Context, userID int64, req model.CreatePost
 				content = "💡 Joke of the day: " + joke
 			}
 		} else if err != nil {
-			slog.Warn("fetch joke failed", "err", err)
+			logger.From(ctx).Warn("fetch joke failed", "err", err)
 		}
 	}
 
@@ -61,47 +103,131 @@ func (s *service) Create(ctx context.Context, userID int64, req model.CreatePost
 	if err := s.pr.Create(ctx, p); err != nil {
 		return nil, err
 	}
+	metrics.PostsCreated.Inc()
 
 	_ = s.log.Log(ctx, model.Activity{
 		UserID:      userID,
-		Action:      "POST_CREATE",
+		Action:      model.ActionPostCreate,
 		Description: fmt.Sprintf("create POST id=%d title=%q", p.ID, p.Title),
+		Metadata:    model.ActivityMetadata{TargetType: model.TargetPost, TargetID: p.ID},
 	})
+	s.events.Publish(ctx, model.EventPostCreated, p, userID)
 	return p, nil
 }
 
-func (s *service) List(ctx context.Context) ([]model.Post, error) {
-	return s.pr.All(ctx)
+func (s *service) List(ctx context.Context, viewerID int64) ([]model.Post, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.List")
+	defer span.End()
+
+	posts, err := s.pr.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.hydrate(ctx, viewerID, posts, true); err != nil {
+		return nil, err
+	}
+	return posts, nil
 }
 
-func (s *service) Detail(ctx context.Context, id int64) (map[string]any, error) {
+func (s *service) Detail(ctx context.Context, id, viewerID int64, q model.DetailQuery) (*model.PostDetail, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.Detail")
+	defer span.End()
+
 	post, err := s.pr.ByID(ctx, id)
-	if err != nil || post == nil {
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
 	}
+	if err != nil {
+		return nil, fmt.Errorf("load post: %w", err)
+	}
+	posts := []model.Post{*post}
+	if err := s.hydrate(ctx, viewerID, posts, false); err != nil {
+		return nil, err
+	}
 
-	likes, _ := s.lr.ListByPost(ctx, id)
-	count, _ := s.lr.CountByPost(ctx, id)
+	if q.LikersLimit == 0 {
+		q.LikersLimit = defaultLikersLimit
+	}
+	likers, err := s.lr.ListLikers(ctx, id, q.LikersLimit, q.LikersOffset)
+	if err != nil {
+		return nil, fmt.Errorf("load likers: %w", err)
+	}
 
-	return map[string]any{
-		"post":        post,
-		"likes":       likes,
-		"likes_count": count,
+	if q.CommentsLimit == 0 {
+		q.CommentsLimit = defaultCommentsLimit
+	}
+	comments, err := s.cr.ListByPost(ctx, id, q.CommentsLimit, q.CommentsOffset)
+	if err != nil {
+		return nil, fmt.Errorf("load comments: %w", err)
+	}
+	commentCount, err := s.cr.CountByPost(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("count comments: %w", err)
+	}
+	if err := s.hydrateComments(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return &model.PostDetail{
+		Post: posts[0],
+		Likers: model.LikerPage{
+			Items:  likers,
+			Total:  post.LikeCount,
+			Limit:  q.LikersLimit,
+			Offset: q.LikersOffset,
+		},
+		Comments: model.CommentPage{
+			Items:  comments,
+			Total:  commentCount,
+			Limit:  q.CommentsLimit,
+			Offset: q.CommentsOffset,
+		},
 	}, nil
 }
 
+func (s *service) AddComment(ctx context.Context, postID, userID int64, req model.CreateCommentReq) (*model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.AddComment")
+	defer span.End()
+
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, ErrBadInput
+	}
+	if _, err := s.pr.ByID(ctx, postID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("load post: %w", err)
+	}
+
+	c := &model.Comment{PostID: postID, UserID: userID, Content: req.Content}
+	if err := s.cr.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	comments := []model.Comment{*c}
+	if err := s.hydrateComments(ctx, comments); err != nil {
+		return nil, err
+	}
+	return &comments[0], nil
+}
+
 func (s *service) Delete(ctx context.Context, id, userID int64) error {
+	ctx, span := tracing.Start(ctx, "postsvc.Delete")
+	defer span.End()
 
 	ok, err := s.pr.DeleteByIDOwner(ctx, id, userID)
 	if err != nil {
 		return err
 	}
 	if ok {
+		s.invalidate(id)
+		metrics.PostsDeleted.Inc()
 		_ = s.log.Log(ctx, model.Activity{
 			UserID:      userID,
-			Action:      "POST_DELETE",
+			Action:      model.ActionPostDelete,
 			Description: fmt.Sprintf("delete POST id=%d", id),
+			Metadata:    model.ActivityMetadata{TargetType: model.TargetPost, TargetID: id},
 		})
+		s.events.Publish(ctx, model.EventPostDeleted, map[string]int64{"id": id, "author_id": userID}, userID)
 		return nil
 	}
 
@@ -110,3 +236,165 @@ func (s *service) Delete(ctx context.Context, id, userID int64) error {
 	}
 	return ErrNotFound
 }
+
+func (s *service) Restore(ctx context.Context, id, userID int64) (*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.Restore")
+	defer span.End()
+
+	ok, err := s.pr.RestoreByIDOwner(ctx, id, userID, time.Now().Add(-s.restoreWindow))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.restoreError(ctx, id, userID)
+	}
+	s.invalidate(id)
+	_ = s.log.Log(ctx, model.Activity{
+		UserID:      userID,
+		Action:      model.ActionPostRestore,
+		Description: fmt.Sprintf("restore POST id=%d", id),
+		Metadata:    model.ActivityMetadata{TargetType: model.TargetPost, TargetID: id},
+	})
+
+	p, err := s.pr.ByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	posts := []model.Post{*p}
+	if err := s.hydrate(ctx, userID, posts, false); err != nil {
+		return nil, err
+	}
+	return &posts[0], nil
+}
+
+// restoreError explains why RestoreByIDOwner matched nothing.
+func (s *service) restoreError(ctx context.Context, id, userID int64) error {
+	p, err := s.pr.DeletedByID(ctx, id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrNotFound
+	case err != nil:
+		return err
+	case p.AuthorID != userID:
+		return ErrNotOwner
+	case p.DeletedAt == nil:
+		return ErrNotDeleted
+	default:
+		return ErrRestoreExpired
+	}
+}
+
+func (s *service) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int64, int64, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.PurgeDeleted")
+	defer span.End()
+
+	cutoff := time.Now().Add(-olderThan)
+	posts, err := s.pr.PurgeDeleted(ctx, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	likes, err := s.lr.PurgeDeleted(ctx, cutoff)
+	return posts, likes, err
+}
+
+// invalidate drops postID from the repo cache, if there is one.
+func (s *service) invalidate(postID int64) {
+	if c, ok := s.pr.(postrepo.Invalidator); ok {
+		c.Invalidate(postID)
+	}
+}
+
+func (s *service) ReconcileLikeCounts(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "postsvc.ReconcileLikeCounts")
+	defer span.End()
+
+	return s.pr.ReconcileLikeCounts(ctx)
+}
+
+// hydrate fills the derived fields of posts with a fixed number of
+// queries however many posts there are: authors and, when recent is set,
+// each post's newest likers come from request-scoped loaders.
+func (s *service) hydrate(ctx context.Context, viewerID int64, posts []model.Post, recent bool) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	if err := s.markLiked(ctx, viewerID, posts); err != nil {
+		return fmt.Errorf("load liked_by_me: %w", err)
+	}
+
+	authorIDs := make([]int64, len(posts))
+	postIDs := make([]int64, len(posts))
+	for i, p := range posts {
+		authorIDs[i] = p.AuthorID
+		postIDs[i] = p.ID
+	}
+	authors, err := loader.For(ctx, usersLoader{}, s.ur.ByIDs).LoadMany(ctx, authorIDs)
+	if err != nil {
+		return fmt.Errorf("load authors: %w", err)
+	}
+	for i := range posts {
+		if u, ok := authors[posts[i].AuthorID]; ok {
+			prof := u.Profile()
+			posts[i].Author = &prof
+		}
+	}
+
+	if !recent {
+		return nil
+	}
+	likers, err := loader.For(ctx, recentLikersLoader{}, s.recentLikers).LoadMany(ctx, postIDs)
+	if err != nil {
+		return fmt.Errorf("load likers: %w", err)
+	}
+	for i := range posts {
+		posts[i].RecentLikers = likers[posts[i].ID]
+	}
+	return nil
+}
+
+// hydrateComments sets each comment's Author through the same request
+// scoped loader as post authors, so people already loaded are not fetched
+// again.
+func (s *service) hydrateComments(ctx context.Context, comments []model.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	userIDs := make([]int64, len(comments))
+	for i, c := range comments {
+		userIDs[i] = c.UserID
+	}
+	authors, err := loader.For(ctx, usersLoader{}, s.ur.ByIDs).LoadMany(ctx, userIDs)
+	if err != nil {
+		return fmt.Errorf("load comment authors: %w", err)
+	}
+	for i := range comments {
+		if u, ok := authors[comments[i].UserID]; ok {
+			prof := u.Profile()
+			comments[i].Author = &prof
+		}
+	}
+	return nil
+}
+
+func (s *service) recentLikers(ctx context.Context, postIDs []int64) (map[int64][]model.Liker, error) {
+	return s.lr.RecentLikers(ctx, postIDs, recentLikersLimit)
+}
+
+// markLiked sets LikedByMe on posts with a single lookup.
+func (s *service) markLiked(ctx context.Context, viewerID int64, posts []model.Post) error {
+	if viewerID == 0 || len(posts) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	liked, err := s.lr.LikedByUser(ctx, viewerID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].LikedByMe = liked[posts[i].ID]
+	}
+	return nil
+}
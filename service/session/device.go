@@ -0,0 +1,89 @@
+package sessionsvc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// deviceIDBytes is the entropy of a device ID, hex-encoded to twice as
+// many characters.
+const deviceIDBytes = 16
+
+func newDeviceID() (string, error) {
+	var b [deviceIDBytes]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func validDeviceID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == deviceIDBytes
+}
+
+// deviceKey is what is stored of a device ID.
+func deviceKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checked in order: Edge and Opera also claim to be Chrome, Chrome claims
+// to be Safari, and iOS and Android claim to be macOS and Linux.
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"okhttp/", "Android app"},
+		{"CFNetwork/", "iOS app"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+		{"Go-http-client/", "Go client"},
+		{"python-requests/", "Python client"},
+	}
+	systems = []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Macintosh", "macOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// deviceName labels a User-Agent coarsely for display, e.g. "Firefox on
+// Windows".
+func deviceName(ua string) string {
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(ua, s.token) {
+			system = s.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Unknown browser on " + system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,9 @@
+package sessionsvc
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("session not found")
+	// ErrEnded covers revoked, expired and unknown sessions alike.
+	ErrEnded = errors.New("session has ended")
+)
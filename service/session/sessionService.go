@@ -0,0 +1,146 @@
+// service/session/sessionService.go
+package sessionsvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"instagram/model"
+	activityrepo "instagram/repository/activity"
+	sessionrepo "instagram/repository/session"
+	"instagram/util/logger"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// touchInterval is how stale last_seen_at may get.
+	touchInterval = time.Minute
+	// retention keeps ended sessions around so that a device used in
+	// that time is not reported as new.
+	retention = 90 * 24 * time.Hour
+	// maxUserAgent bounds what is stored of a User-Agent header.
+	maxUserAgent = 512
+)
+
+type Service interface {
+	// Start records a login by userID from client, lasting as long as its
+	// token, and logs an activity when the device is new to the user. A
+	// client without a well-formed device ID gets a new one.
+	Start(ctx context.Context, userID int64, client model.Client) (*model.Session, error)
+	// List returns userID's live sessions, marking currentID.
+	List(ctx context.Context, userID, currentID int64) ([]model.Session, error)
+	// Revoke ends a session; its token stops working at once.
+	Revoke(ctx context.Context, id, userID int64) error
+	// Check confirms session id of userID is live and records the use.
+	Check(ctx context.Context, id, userID int64) error
+	// Purge deletes sessions that ended long ago.
+	Purge(ctx context.Context) (int64, error)
+}
+
+type service struct {
+	r   sessionrepo.Repo
+	log activityrepo.Repo
+	ttl time.Duration
+}
+
+// New creates the service; ttl is the login token lifetime.
+func New(r sessionrepo.Repo, log activityrepo.Repo, ttl time.Duration) Service {
+	return &service{r: r, log: log, ttl: ttl}
+}
+
+func (s *service) Start(ctx context.Context, userID int64, client model.Client) (*model.Session, error) {
+	ctx, span := tracing.Start(ctx, "sessionsvc.Start")
+	defer span.End()
+
+	ua := client.UserAgent
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	deviceID := client.DeviceID
+	if !validDeviceID(deviceID) {
+		var err error
+		if deviceID, err = newDeviceID(); err != nil {
+			return nil, err
+		}
+	}
+	sess := &model.Session{
+		UserID:    userID,
+		Device:    deviceName(client.UserAgent),
+		UserAgent: ua,
+		IP:        client.IP,
+		ExpiresAt: time.Now().Add(s.ttl),
+		DeviceID:  deviceID,
+	}
+	newDevice, err := s.r.Create(ctx, sess, deviceKey(deviceID))
+	if err != nil {
+		return nil, err
+	}
+	if newDevice {
+		_ = s.log.Log(ctx, model.Activity{
+			UserID:      userID,
+			Action:      model.ActionNewDevice,
+			Description: fmt.Sprintf("login from new device %q ip=%s session id=%d", sess.Device, sess.IP, sess.ID),
+			Metadata:    model.ActivityMetadata{TargetType: model.TargetSession, TargetID: sess.ID},
+		})
+	}
+	return sess, nil
+}
+
+func (s *service) List(ctx context.Context, userID, currentID int64) ([]model.Session, error) {
+	ctx, span := tracing.Start(ctx, "sessionsvc.List")
+	defer span.End()
+
+	out, err := s.r.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Current = out[i].ID == currentID
+	}
+	return out, nil
+}
+
+func (s *service) Revoke(ctx context.Context, id, userID int64) error {
+	ctx, span := tracing.Start(ctx, "sessionsvc.Revoke")
+	defer span.End()
+
+	ok, err := s.r.RevokeByIDOwner(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) Check(ctx context.Context, id, userID int64) error {
+	ctx, span := tracing.Start(ctx, "sessionsvc.Check")
+	defer span.End()
+
+	sess, err := s.r.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrEnded
+	}
+	if err != nil {
+		return err
+	}
+	if sess.UserID != userID || sess.RevokedAt != nil || time.Now().After(sess.ExpiresAt) {
+		return ErrEnded
+	}
+	if err := s.r.Touch(ctx, id, touchInterval); err != nil {
+		logger.From(ctx).Warn("record session use failed", "session_id", id, "err", err)
+	}
+	return nil
+}
+
+func (s *service) Purge(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "sessionsvc.Purge")
+	defer span.End()
+
+	return s.r.PurgeEnded(ctx, time.Now().Add(-retention))
+}
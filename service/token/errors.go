@@ -0,0 +1,9 @@
+package tokensvc
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("access token not found")
+	// ErrInvalidToken covers unknown, revoked and expired tokens alike.
+	ErrInvalidToken = errors.New("invalid access token")
+)
@@ -0,0 +1,10 @@
+package webhooksvc
+
+import "errors"
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrGlobalForbidden  = errors.New("only admins can create global webhooks")
+	ErrInsecureURL      = errors.New("webhook url must use https")
+)
@@ -0,0 +1,395 @@
+// service/webhook/webhookService.go
+package webhooksvc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"instagram/model"
+	userrepo "instagram/repository/user"
+	webhookrepo "instagram/repository/webhook"
+	jobsvc "instagram/service/job"
+	"instagram/util/httpx"
+	"instagram/util/logger"
+	"instagram/util/metrics"
+	"instagram/util/tracing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Publisher is the part of Service that other services emit events with.
+type Publisher interface {
+	// Publish queues event for the webhooks of userIDs, the users it
+	// involves, and global webhooks. It never fails the caller: a lost
+	// event is logged.
+	Publish(ctx context.Context, event string, data any, userIDs ...int64)
+}
+
+type Service interface {
+	Publisher
+	Create(ctx context.Context, userID int64, req model.CreateWebhookReq) (*model.Webhook, error)
+	List(ctx context.Context, userID int64) ([]model.Webhook, error)
+	Delete(ctx context.Context, id, userID int64) error
+	// Deliveries pages through a webhook's delivery log, newest first.
+	Deliveries(ctx context.Context, id, userID, beforeID int64, limit int) (*model.DeliveryPage, error)
+	// Replay sends a past delivery again as a new delivery.
+	Replay(ctx context.Context, id, deliveryID, userID int64) (*model.WebhookDelivery, error)
+	// Purge deletes settled deliveries older than the retention.
+	Purge(ctx context.Context) (int64, error)
+
+	// HandleFanout and HandleDeliver are the JobFanout and JobDeliver
+	// handlers.
+	HandleFanout(ctx context.Context, j *model.Job) error
+	HandleDeliver(ctx context.Context, j *model.Job) error
+}
+
+type Options struct {
+	// Client sends deliveries; see httpx.UntrustedClient.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed.
+	MaxAttempts int
+	// AllowHTTP accepts plain http targets, e.g. for local development;
+	// otherwise they must be https.
+	AllowHTTP bool
+	// Retention is how long settled deliveries are kept.
+	Retention time.Duration
+}
+
+// Job kinds. A published event is one fan-out job, which records a
+// delivery per subscribed webhook and queues a deliver job for each.
+const (
+	JobFanout  = "webhook.fanout"
+	JobDeliver = "webhook.deliver"
+)
+
+// Request headers sent with every delivery. The signature is
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the
+// webhook secret>".
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	defaultPageSize = 50
+	// maxErrorBody is how much of a failed response is kept in the log.
+	maxErrorBody = 512
+)
+
+type fanoutPayload struct {
+	Event      string          `json:"event"`
+	UserIDs    []int64         `json:"user_ids"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type deliverPayload struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+// envelope is the delivery body. ID identifies the event, so receivers
+// can drop duplicates and replays.
+type envelope struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type service struct {
+	wr   webhookrepo.Repo
+	ur   userrepo.Repo
+	jobs jobsvc.Enqueuer
+	opt  Options
+}
+
+func New(wr webhookrepo.Repo, ur userrepo.Repo, jobs jobsvc.Enqueuer, opt Options) Service {
+	if opt.Client == nil {
+		opt.Client = httpx.UntrustedClient(false)
+	}
+	return &service{wr: wr, ur: ur, jobs: jobs, opt: opt}
+}
+
+func (s *service) Publish(ctx context.Context, event string, data any, userIDs ...int64) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Publish")
+	defer span.End()
+
+	raw, err := json.Marshal(data)
+	if err == nil {
+		_, err = s.jobs.Enqueue(ctx, JobFanout, fanoutPayload{
+			Event:      event,
+			UserIDs:    userIDs,
+			OccurredAt: time.Now(),
+			Data:       raw,
+		})
+	}
+	if err != nil {
+		tracing.Fail(span, err)
+		logger.From(ctx).Error("publish webhook event failed", "event", event, "err", err)
+	}
+}
+
+func (s *service) Create(ctx context.Context, userID int64, req model.CreateWebhookReq) (*model.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Create")
+	defer span.End()
+
+	target, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "https" && !(target.Scheme == "http" && s.opt.AllowHTTP) {
+		return nil, ErrInsecureURL
+	}
+	if req.Global {
+		u, err := s.ur.ByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if u.Role != model.RoleAdmin {
+			return nil, ErrGlobalForbidden
+		}
+	}
+	secret := req.Secret
+	if secret == "" {
+		var b [32]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		secret = "whsec_" + hex.EncodeToString(b[:])
+	}
+	w := &model.Webhook{
+		UserID: userID,
+		URL:    req.URL,
+		Events: req.Events,
+		Global: req.Global,
+		Secret: secret,
+	}
+	if err := s.wr.Create(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *service) List(ctx context.Context, userID int64) ([]model.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.List")
+	defer span.End()
+
+	ws, err := s.wr.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ws {
+		ws[i].Secret = ""
+	}
+	return ws, nil
+}
+
+func (s *service) Delete(ctx context.Context, id, userID int64) error {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Delete")
+	defer span.End()
+
+	ok, err := s.wr.DeleteByIDOwner(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) Deliveries(ctx context.Context, id, userID, beforeID int64, limit int) (*model.DeliveryPage, error) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Deliveries")
+	defer span.End()
+
+	if _, err := s.owned(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	ds, err := s.wr.ListDeliveries(ctx, id, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.DeliveryPage{Items: ds}
+	if len(ds) > limit {
+		page.Items = ds[:limit]
+		next := page.Items[limit-1].ID
+		page.NextBeforeID = &next
+	}
+	return page, nil
+}
+
+func (s *service) Replay(ctx context.Context, id, deliveryID, userID int64) (*model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Replay")
+	defer span.End()
+
+	if _, err := s.owned(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	orig, err := s.wr.Delivery(ctx, deliveryID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && orig.WebhookID != id) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.wr.CreateReplay(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueueDelivery(ctx, d.ID); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *service) Purge(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "webhooksvc.Purge")
+	defer span.End()
+
+	return s.wr.PurgeDeliveries(ctx, time.Now().Add(-s.opt.Retention))
+}
+
+// owned loads webhook id if userID owns it.
+func (s *service) owned(ctx context.Context, id, userID int64) (*model.Webhook, error) {
+	w, err := s.wr.ByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && w.UserID != userID) {
+		return nil, ErrNotFound
+	}
+	return w, err
+}
+
+func (s *service) enqueueDelivery(ctx context.Context, deliveryID int64) error {
+	_, err := s.jobs.Enqueue(ctx, JobDeliver, deliverPayload{DeliveryID: deliveryID},
+		jobsvc.MaxAttempts(s.opt.MaxAttempts),
+		jobsvc.UniqueKey(fmt.Sprintf("webhook-delivery:%d", deliveryID)))
+	return err
+}
+
+func (s *service) HandleFanout(ctx context.Context, j *model.Job) error {
+	ctx, span := tracing.Start(ctx, "webhooksvc.HandleFanout")
+	defer span.End()
+
+	var p fanoutPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return jobsvc.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	body, err := json.Marshal(envelope{ID: j.ID, Event: p.Event, CreatedAt: p.OccurredAt, Data: p.Data})
+	if err != nil {
+		return jobsvc.Permanent(err)
+	}
+	// Retries find the deliveries already recorded, and the unique key
+	// stops their jobs from being queued twice.
+	ids, err := s.wr.CreateDeliveries(ctx, j.ID, p.Event, p.UserIDs, body)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.enqueueDelivery(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) HandleDeliver(ctx context.Context, j *model.Job) error {
+	ctx, span := tracing.Start(ctx, "webhooksvc.HandleDeliver")
+	defer span.End()
+
+	var p deliverPayload
+	if err := json.Unmarshal(j.Payload, &p); err != nil {
+		return jobsvc.Permanent(fmt.Errorf("decode payload: %w", err))
+	}
+	d, err := s.wr.Delivery(ctx, p.DeliveryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Deleted along with its webhook.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if d.Status != model.DeliveryPending {
+		return nil
+	}
+	w, err := s.wr.ByID(ctx, d.WebhookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	respStatus, sendErr := s.send(ctx, w, d)
+	status := model.DeliverySucceeded
+	var msg string
+	if sendErr != nil {
+		tracing.Fail(span, sendErr)
+		metrics.WebhookDeliveries.WithLabelValues(d.Event, "error").Inc()
+		msg = sendErr.Error()
+		status = model.DeliveryPending
+		if (j.LastAttempt() && !jobsvc.Interrupted(ctx)) || errors.Is(sendErr, httpx.ErrForbiddenAddress) {
+			status = model.DeliveryFailed
+			sendErr = jobsvc.Permanent(sendErr)
+		}
+	} else {
+		metrics.WebhookDeliveries.WithLabelValues(d.Event, "success").Inc()
+	}
+	if err := s.wr.RecordAttempt(context.WithoutCancel(ctx), d.ID, status, respStatus, msg); err != nil {
+		logger.From(ctx).Error("record webhook attempt failed", "delivery_id", d.ID, "err", err)
+	}
+	return sendErr
+}
+
+// send POSTs the delivery and returns the response status, if there was
+// a response. Anything but a 2xx is an error.
+func (s *service) send(ctx context.Context, w *model.Webhook, d *model.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "instagram-webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, time.Now(), d.Payload))
+
+	resp, err := s.opt.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	code := resp.StatusCode
+	if code >= 200 && code < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return &code, nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &code, fmt.Errorf("HTTP %d: %s", code, bytes.TrimSpace(snippet))
+}
+
+// Sign returns the signature header value for body sent at t. Receivers
+// recompute it with their copy of the secret and should reject old t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(m.Sum(nil))
+}
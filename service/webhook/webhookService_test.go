@@ -0,0 +1,262 @@
+package webhooksvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"instagram/model"
+	webhookrepo "instagram/repository/webhook"
+	jobsvc "instagram/service/job"
+	"instagram/util/httpx"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+// fakeRepo keeps webhooks and deliveries in memory.
+type fakeRepo struct {
+	webhookrepo.Repo
+	webhooks   map[int64]*model.Webhook
+	deliveries map[int64]*model.WebhookDelivery
+	nextID     int64
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{webhooks: map[int64]*model.Webhook{}, deliveries: map[int64]*model.WebhookDelivery{}, nextID: 100}
+}
+
+func (r *fakeRepo) Create(_ context.Context, w *model.Webhook) error {
+	r.nextID++
+	w.ID = r.nextID
+	c := *w
+	r.webhooks[w.ID] = &c
+	return nil
+}
+
+func (r *fakeRepo) ByID(_ context.Context, id int64) (*model.Webhook, error) {
+	w, ok := r.webhooks[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	c := *w
+	return &c, nil
+}
+
+func (r *fakeRepo) Delivery(_ context.Context, id int64) (*model.WebhookDelivery, error) {
+	d, ok := r.deliveries[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	c := *d
+	return &c, nil
+}
+
+func (r *fakeRepo) CreateReplay(_ context.Context, deliveryID int64) (*model.WebhookDelivery, error) {
+	orig := r.deliveries[deliveryID]
+	r.nextID++
+	d := &model.WebhookDelivery{
+		ID:        r.nextID,
+		WebhookID: orig.WebhookID,
+		Event:     orig.Event,
+		Payload:   orig.Payload,
+		Status:    model.DeliveryPending,
+		ReplayOf:  &orig.ID,
+	}
+	r.deliveries[d.ID] = d
+	c := *d
+	return &c, nil
+}
+
+func (r *fakeRepo) RecordAttempt(_ context.Context, id int64, status model.DeliveryStatus, respStatus *int, errMsg string) error {
+	d := r.deliveries[id]
+	d.Status = status
+	d.Attempts++
+	d.ResponseStatus = respStatus
+	d.Error = errMsg
+	return nil
+}
+
+// fakeJobs records what was enqueued.
+type fakeJobs struct{ deliveries []int64 }
+
+func (j *fakeJobs) Enqueue(_ context.Context, kind string, payload any, _ ...jobsvc.EnqueueOption) (*model.Job, error) {
+	if p, ok := payload.(deliverPayload); ok && kind == JobDeliver {
+		j.deliveries = append(j.deliveries, p.DeliveryID)
+	}
+	return &model.Job{Kind: kind}, nil
+}
+
+// setup stores a webhook for user 1 pointing at url with one pending
+// delivery, and returns the service and the delivery.
+func setup(t *testing.T, url string, client *http.Client) (*service, *fakeRepo, *fakeJobs, *model.WebhookDelivery) {
+	t.Helper()
+	r := newFakeRepo()
+	jobs := &fakeJobs{}
+	w := &model.Webhook{UserID: 1, URL: url, Events: []string{model.EventPostCreated}, Secret: testSecret}
+	if err := r.Create(context.Background(), w); err != nil {
+		t.Fatal(err)
+	}
+	r.nextID++
+	d := &model.WebhookDelivery{
+		ID:        r.nextID,
+		WebhookID: w.ID,
+		Event:     model.EventPostCreated,
+		Payload:   json.RawMessage(`{"id":7,"event":"post.created","data":{"id":3}}`),
+		Status:    model.DeliveryPending,
+	}
+	r.deliveries[d.ID] = d
+	s := New(r, nil, jobs, Options{Client: client, MaxAttempts: 3}).(*service)
+	return s, r, jobs, d
+}
+
+func deliverJob(t *testing.T, d *model.WebhookDelivery, attempt int) *model.Job {
+	t.Helper()
+	raw, err := json.Marshal(deliverPayload{DeliveryID: d.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.Job{ID: 1, Kind: JobDeliver, Payload: raw, Attempts: attempt, MaxAttempts: 3}
+}
+
+func TestHandleDeliverSignsRequest(t *testing.T) {
+	var header string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(HeaderSignature)
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	s, r, _, d := setup(t, srv.URL, httpx.UntrustedClient(true))
+
+	if err := s.HandleDeliver(context.Background(), deliverJob(t, d, 1)); err != nil {
+		t.Fatalf("HandleDeliver: %v", err)
+	}
+	if string(body) != string(d.Payload) {
+		t.Errorf("body = %s, want %s", body, d.Payload)
+	}
+	ts, _, ok := strings.Cut(strings.TrimPrefix(header, "t="), ",")
+	if !ok {
+		t.Fatalf("malformed signature header %q", header)
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("signature timestamp: %v", err)
+	}
+	if want := Sign(testSecret, time.Unix(sec, 0), body); header != want {
+		t.Errorf("signature = %q, want %q", header, want)
+	}
+	if got := r.deliveries[d.ID].Status; got != model.DeliverySucceeded {
+		t.Errorf("status = %s, want %s", got, model.DeliverySucceeded)
+	}
+}
+
+func TestHandleDeliverRetriesNon2xx(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	s, r, _, d := setup(t, srv.URL, httpx.UntrustedClient(true))
+
+	err := s.HandleDeliver(context.Background(), deliverJob(t, d, 1))
+	if err == nil {
+		t.Fatal("HandleDeliver succeeded on a 503")
+	}
+	if jobsvc.IsPermanent(err) {
+		t.Errorf("error %v is permanent, want retryable", err)
+	}
+	got := r.deliveries[d.ID]
+	if got.Status != model.DeliveryPending {
+		t.Errorf("status = %s, want %s", got.Status, model.DeliveryPending)
+	}
+	if got.ResponseStatus == nil || *got.ResponseStatus != http.StatusServiceUnavailable {
+		t.Errorf("response status = %v, want 503", got.ResponseStatus)
+	}
+}
+
+func TestHandleDeliverGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		client  *http.Client
+		attempt int
+		wantErr error
+	}{
+		{"last attempt", httpx.UntrustedClient(true), 3, nil},
+		{"forbidden address", httpx.UntrustedClient(false), 1, httpx.ErrForbiddenAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, r, _, d := setup(t, srv.URL, tt.client)
+
+			err := s.HandleDeliver(context.Background(), deliverJob(t, d, tt.attempt))
+			if !jobsvc.IsPermanent(err) {
+				t.Errorf("error %v is not permanent", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+			if got := r.deliveries[d.ID].Status; got != model.DeliveryFailed {
+				t.Errorf("status = %s, want %s", got, model.DeliveryFailed)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s, r, jobs, d := setup(t, "https://example.com/hook", nil)
+	r.deliveries[d.ID].Status = model.DeliveryFailed
+
+	got, err := s.Replay(context.Background(), d.WebhookID, d.ID, 1)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if got.ID == d.ID {
+		t.Fatal("replay reused the original delivery")
+	}
+	if got.ReplayOf == nil || *got.ReplayOf != d.ID {
+		t.Errorf("replay_of = %v, want %d", got.ReplayOf, d.ID)
+	}
+	if got.Status != model.DeliveryPending {
+		t.Errorf("status = %s, want %s", got.Status, model.DeliveryPending)
+	}
+	if len(jobs.deliveries) != 1 || jobs.deliveries[0] != got.ID {
+		t.Errorf("queued deliveries = %v, want [%d]", jobs.deliveries, got.ID)
+	}
+	if _, err := s.Replay(context.Background(), d.WebhookID, d.ID, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("replay by another user: err = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCreateRequiresHTTPS(t *testing.T) {
+	tests := []struct {
+		url       string
+		allowHTTP bool
+		wantErr   error
+	}{
+		{"https://example.com/hook", false, nil},
+		{"http://example.com/hook", false, ErrInsecureURL},
+		{"http://localhost:9000/hook", true, nil},
+		{"ftp://example.com/hook", true, ErrInsecureURL},
+	}
+	for _, tt := range tests {
+		s := New(newFakeRepo(), nil, &fakeJobs{}, Options{AllowHTTP: tt.allowHTTP})
+		_, err := s.Create(context.Background(), 1, model.CreateWebhookReq{URL: tt.url, Events: []string{model.EventPostCreated}})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Create(%q, allowHTTP=%v): err = %v, want %v", tt.url, tt.allowHTTP, err, tt.wantErr)
+		}
+	}
+}
@@ -14,6 +14,10 @@ CREATE TABLE IF NOT EXISTS users (
   )
 );
 
+-- role gates admin endpoints; promote with UPDATE users SET role = 'admin'.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user'
+  CHECK (role IN ('user', 'admin'));
+
 CREATE TABLE IF NOT EXISTS categories (
   id   BIGSERIAL PRIMARY KEY,
   name VARCHAR(100) NOT NULL UNIQUE
@@ -28,22 +32,306 @@ CREATE TABLE IF NOT EXISTS articles (
   created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS posts (
+  id           BIGSERIAL PRIMARY KEY,
+  title        VARCHAR(200) NOT NULL,
+  content      TEXT NOT NULL,
+  author_id    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  like_count   BIGINT NOT NULL DEFAULT 0 CHECK (like_count >= 0),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  deleted_at   TIMESTAMPTZ
+);
+
+-- For databases created before like_count existed.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS like_count BIGINT NOT NULL DEFAULT 0;
+
+-- Soft delete: reads skip rows with deleted_at set; the purge worker
+-- hard-deletes them after the retention window.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- One like per user and post: the unique key backs idempotent PUT /like.
 CREATE TABLE IF NOT EXISTS likes (
   id          BIGSERIAL PRIMARY KEY,
-  user_id     BIGINT NOT NULL REFERENCES users(id)     ON DELETE CASCADE,
-  article_id  BIGINT NOT NULL REFERENCES articles(id)  ON DELETE CASCADE,
+  user_id     BIGINT NOT NULL REFERENCES users(id)  ON DELETE CASCADE,
+  post_id     BIGINT NOT NULL REFERENCES posts(id)  ON DELETE CASCADE,
   created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-  UNIQUE (user_id, article_id)
+  deleted_at  TIMESTAMPTZ,
+  UNIQUE (user_id, post_id)
 );
 
+CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes(post_id);
+
+-- A soft-deleted like keeps its (user_id, post_id) slot; liking again
+-- clears deleted_at instead of inserting.
+ALTER TABLE likes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_likes_deleted_at ON likes(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Keeps posts.like_count (live likes only) in step with likes inside the
+-- same transaction. Soft delete and revival arrive as UPDATEs of
+-- deleted_at. The reconciliation worker repairs any drift (e.g. manual
+-- SQL edits).
+CREATE OR REPLACE FUNCTION likes_maintain_post_count() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' AND NEW.deleted_at IS NULL THEN
+    UPDATE posts SET like_count = like_count + 1 WHERE id = NEW.post_id;
+  ELSIF TG_OP = 'DELETE' AND OLD.deleted_at IS NULL THEN
+    UPDATE posts SET like_count = GREATEST(like_count - 1, 0) WHERE id = OLD.post_id;
+  ELSIF TG_OP = 'UPDATE' AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    UPDATE posts SET like_count = GREATEST(like_count - 1, 0) WHERE id = NEW.post_id;
+  ELSIF TG_OP = 'UPDATE' AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    UPDATE posts SET like_count = like_count + 1 WHERE id = NEW.post_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_likes_post_count ON likes;
+CREATE TRIGGER trg_likes_post_count
+  AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON likes
+  FOR EACH ROW EXECUTE FUNCTION likes_maintain_post_count();
+
 CREATE TABLE IF NOT EXISTS user_activity_logs (
   id          BIGSERIAL PRIMARY KEY,
   user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
   action      VARCHAR(64) NOT NULL,        
   description TEXT NOT NULL,
+  metadata    JSONB NOT NULL DEFAULT '{}',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- metadata holds the activity target ({"target_type":"post","target_id":1})
+-- so it can be filtered on; older rows only had it in the description.
+ALTER TABLE user_activity_logs ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+UPDATE user_activity_logs
+SET metadata = jsonb_build_object('target_type', 'post', 'target_id', substring(description FROM 'POST id=(\d+)')::bigint)
+WHERE metadata = '{}' AND description ~ 'POST id=\d+';
+
+CREATE INDEX IF NOT EXISTS idx_user_activity_logs_user_id ON user_activity_logs(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_user_activity_logs_metadata ON user_activity_logs USING GIN (metadata jsonb_path_ops);
+
+-- Comments on posts, listed oldest first under GET /v1/posts/:id. They
+-- go with the post when it is purged and with the author's account.
+CREATE TABLE IF NOT EXISTS comments (
+  id          BIGSERIAL PRIMARY KEY,
+  post_id     BIGINT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  content     TEXT NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id, id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);
+
+-- Stored responses for POST retries carrying an Idempotency-Key header.
+-- status_code/response_body stay NULL while the first request is in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  key           VARCHAR(255) NOT NULL,
+  request_hash  CHAR(64) NOT NULL,
+  status_code   INT,
+  content_type  TEXT,
+  response_body BYTEA,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at  TIMESTAMPTZ,
+  expires_at    TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- Personal data exports (takeout archives). At most one export per user
+-- is pending or running; ready archives are deleted from disk and marked
+-- expired after the retention window.
+CREATE TABLE IF NOT EXISTS data_exports (
+  id            BIGSERIAL PRIMARY KEY,
+  user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status        VARCHAR(16) NOT NULL DEFAULT 'pending'
+                CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+  file_path     TEXT,
+  size_bytes    BIGINT,
+  error         TEXT,
+  attempts      INT NOT NULL DEFAULT 0,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at    TIMESTAMPTZ,
+  completed_at  TIMESTAMPTZ,
+  expires_at    TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_data_exports_active ON data_exports(user_id) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id, id DESC);
+
+-- Background job queue. Workers claim runnable rows with
+-- FOR UPDATE SKIP LOCKED; locked_at doubles as the claim token so a
+-- worker whose lock timed out can't finish a job someone else reclaimed.
+-- Failed jobs go back to 'queued' with a later run_at until max_attempts,
+-- then to 'dead' for an admin to inspect and retry.
+CREATE TABLE IF NOT EXISTS jobs (
+  id            BIGSERIAL PRIMARY KEY,
+  kind          VARCHAR(64) NOT NULL,
+  payload       JSONB NOT NULL DEFAULT '{}',
+  status        VARCHAR(16) NOT NULL DEFAULT 'queued'
+                CHECK (status IN ('queued', 'running', 'done', 'dead')),
+  attempts      INT NOT NULL DEFAULT 0,
+  max_attempts  INT NOT NULL DEFAULT 5,
+  run_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  locked_at     TIMESTAMPTZ,
+  last_error    TEXT,
+  -- Set on scheduled runs ("cron:<kind>:<unix>") so every instance can
+  -- enqueue the next run and only one row wins.
+  unique_key    TEXT,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  finished_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_runnable ON jobs(run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(locked_at) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, id DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_jobs_unique_key ON jobs(unique_key);
+
+-- Outgoing webhooks. A subscription receives the events it lists that
+-- involve its owner; global ones, which only admins create, receive them
+-- for every user. The secret signs deliveries, so it is kept in clear.
+CREATE TABLE IF NOT EXISTS webhooks (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  url         TEXT NOT NULL,
+  events      TEXT[] NOT NULL,
+  secret      TEXT NOT NULL,
+  global      BOOLEAN NOT NULL DEFAULT FALSE,
   created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks(user_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_global ON webhooks(id) WHERE global;
+
+-- One row per event per webhook; replays add a row pointing at the
+-- original. event_id is the fan-out job's ID and makes fan-out retries
+-- idempotent.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               BIGSERIAL PRIMARY KEY,
+  webhook_id       BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_id         BIGINT,
+  event            VARCHAR(32) NOT NULL,
+  payload          JSONB NOT NULL,
+  status           VARCHAR(16) NOT NULL DEFAULT 'pending'
+                   CHECK (status IN ('pending', 'succeeded', 'failed')),
+  attempts         INT NOT NULL DEFAULT 0,
+  response_status  INT,
+  error            TEXT,
+  replay_of        BIGINT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_attempt_at  TIMESTAMPTZ,
+  delivered_at     TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_webhook_deliveries_event ON webhook_deliveries(webhook_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_finished ON webhook_deliveries(created_at) WHERE status <> 'pending';
+
+-- Personal access tokens for scripts and bots. Only a SHA-256 of the
+-- token is kept; prefix is its first characters, shown in listings so
+-- users can tell tokens apart.
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id            BIGSERIAL PRIMARY KEY,
+  user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name          VARCHAR(100) NOT NULL,
+  token_hash    CHAR(64) NOT NULL UNIQUE,
+  prefix        VARCHAR(16) NOT NULL,
+  scopes        TEXT[] NOT NULL,
+  expires_at    TIMESTAMPTZ NOT NULL,
+  last_used_at  TIMESTAMPTZ,
+  revoked_at    TIMESTAMPTZ,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id, id DESC);
+
+-- External sign-in identities (OpenID Connect), keyed by the provider's
+-- issuer and its stable subject ID for the user.
+CREATE TABLE IF NOT EXISTS user_identities (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  issuer      TEXT NOT NULL,
+  subject     TEXT NOT NULL,
+  email       VARCHAR(191),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- In-flight OIDC logins: the state sent to the provider and the nonce
+-- and PKCE verifier it must be redeemed with. Rows are single-use and
+-- short-lived.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+  state          TEXT PRIMARY KEY,
+  nonce          TEXT NOT NULL,
+  code_verifier  TEXT NOT NULL,
+  created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_created_at ON oidc_login_states(created_at);
+
+-- JWT signing keys, shared by every instance. private_key is the PKCS #8
+-- key sealed with AES-GCM. A key is published in the JWKS as soon as it
+-- is created, signs from activates_at until a newer key activates, and
+-- is dropped once no token it signed can still be valid.
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+  kid           TEXT PRIMARY KEY,
+  alg           VARCHAR(16) NOT NULL,
+  private_key   BYTEA NOT NULL,
+  activates_at  TIMESTAMPTZ NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Two-factor authentication with TOTP. secret is the seed sealed with
+-- AES-GCM; 2FA is on once enabled_at is set. last_step is the newest
+-- time step accepted, so codes can't be replayed. Wrong codes count
+-- towards a temporary lock.
+CREATE TABLE IF NOT EXISTS user_totp (
+  user_id          BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret           BYTEA NOT NULL,
+  enabled_at       TIMESTAMPTZ,
+  last_step        BIGINT NOT NULL DEFAULT 0,
+  failed_attempts  INT NOT NULL DEFAULT 0,
+  locked_until     TIMESTAMPTZ,
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One-time 2FA recovery codes, kept as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash   CHAR(64) NOT NULL,
+  used_at     TIMESTAMPTZ,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, code_hash)
+);
+
+-- Login sessions, one per issued login token (its sid claim). Revoking a
+-- session rejects its token. device is a coarse label parsed from
+-- user_agent ("Firefox on Windows") for display. device_key is a SHA-256
+-- of the random device ID handed to the client at its first login and
+-- presented on later ones; a login without one the user has used before
+-- is from a new device.
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id            BIGSERIAL PRIMARY KEY,
+  user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  device        VARCHAR(100) NOT NULL,
+  device_key    CHAR(64) NOT NULL,
+  user_agent    TEXT NOT NULL,
+  ip            TEXT NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at    TIMESTAMPTZ NOT NULL,
+  revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_device_key ON user_sessions(user_id, device_key);
+
 
 INSERT INTO categories(name) VALUES
   ('General'), ('Tech'), ('Lifestyle')
@@ -0,0 +1,41 @@
+// Package auth issues and verifies login tokens and carries the
+// authenticated caller, the Principal, in request contexts.
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+type ctxKey struct{}
+
+// Principal is who a request acts for: a user signed in with a login
+// token, or a script using one of their personal access tokens.
+type Principal struct {
+	UserID int64
+	// Role is the role the login token was issued with, which may since
+	// have changed; empty for access tokens.
+	Role string
+	// Scopes limits an access token. Logins have none and may do anything.
+	Scopes []string
+	// TokenID is the personal access token in use, 0 for logins.
+	TokenID int64
+	// SessionID is the login session, 0 for access tokens.
+	SessionID int64
+}
+
+// HasScope reports whether p may use scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p.TokenID == 0 || slices.Contains(p.Scopes, scope)
+}
+
+// WithPrincipal returns ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// From returns the principal in ctx, if the request was authenticated.
+func From(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	jwtutil "instagram/util/jwt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken covers every rejected login token; the reason is not
+// shown to callers.
+var ErrInvalidToken = errors.New("invalid or missing token")
+
+const (
+	// leeway absorbs clock skew between instances for exp, nbf and iat.
+	leeway = 30 * time.Second
+	// challengeTTL bounds how long a 2FA challenge can be answered.
+	challengeTTL = 5 * time.Minute
+)
+
+type TokenOptions struct {
+	// Issuer and Audience are set on issued tokens and required on
+	// verified ones.
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+}
+
+// Tokens issues and verifies login JWTs signed with a key set, and the
+// challenge tokens that stand in for them until a second factor is given.
+// Challenges carry their own audience, so neither passes for the other.
+type Tokens struct {
+	keys      *jwtutil.KeySet
+	opt       TokenOptions
+	parser    *jwt.Parser
+	challenge *jwt.Parser
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+	// SessionID ties a login token to its session, which can be revoked.
+	SessionID int64 `json:"sid,omitempty"`
+}
+
+func NewTokens(keys *jwtutil.KeySet, opt TokenOptions) *Tokens {
+	return &Tokens{
+		keys:      keys,
+		opt:       opt,
+		parser:    newParser(opt.Issuer, opt.Audience),
+		challenge: newParser(opt.Issuer, challengeAudience(opt.Audience)),
+	}
+}
+
+func newParser(issuer, audience string) *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithValidMethods(jwtutil.ValidMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+}
+
+func challengeAudience(audience string) string { return audience + "/2fa" }
+
+// Issue signs a login token for userID's session sessionID.
+func (t *Tokens) Issue(userID int64, role string, sessionID int64) (string, error) {
+	return t.sign(userID, role, sessionID, t.opt.Audience, t.opt.TTL)
+}
+
+// IssueChallenge signs a token showing userID passed the password step
+// of a login, to be redeemed with a second factor.
+func (t *Tokens) IssueChallenge(userID int64) (string, time.Time, error) {
+	tok, err := t.sign(userID, "", 0, challengeAudience(t.opt.Audience), challengeTTL)
+	return tok, time.Now().Add(challengeTTL), err
+}
+
+func (t *Tokens) sign(userID int64, role string, sessionID int64, audience string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return t.keys.Sign(claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.opt.Issuer,
+			Subject:   strconv.FormatInt(userID, 10),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Role:      role,
+		SessionID: sessionID,
+	})
+}
+
+// Verify checks raw's signature and its iss, aud, exp, nbf and iat
+// claims and returns the principal it was issued to. Whether its session
+// is still live is for the caller to check.
+func (t *Tokens) Verify(raw string) (*Principal, error) {
+	c, err := t.parse(t.parser, raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.SessionID <= 0 {
+		return nil, ErrInvalidToken
+	}
+	return &Principal{UserID: c.userID, Role: c.Role, SessionID: c.SessionID}, nil
+}
+
+// VerifyChallenge returns the user a challenge token was issued to.
+func (t *Tokens) VerifyChallenge(raw string) (int64, error) {
+	c, err := t.parse(t.challenge, raw)
+	if err != nil {
+		return 0, err
+	}
+	return c.userID, nil
+}
+
+type verified struct {
+	claims
+	userID int64
+}
+
+func (t *Tokens) parse(p *jwt.Parser, raw string) (*verified, error) {
+	var c claims
+	if _, err := p.ParseWithClaims(raw, &c, t.keys.Keyfunc); err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	uid, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || uid <= 0 {
+		return nil, ErrInvalidToken
+	}
+	return &verified{c, uid}, nil
+}
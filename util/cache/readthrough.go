@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"instagram/util/metrics"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ReadThrough fills a Cache from a loader on miss. Concurrent misses for
+// the same key share one load.
+type ReadThrough[K comparable, V any] struct {
+	name  string
+	c     Cache[K, V]
+	group singleflight.Group
+
+	// gen is bumped by Invalidate so a load that started before the
+	// invalidation doesn't write its now stale result back. One counter
+	// for all keys keeps it bounded; the cost is an occasional extra miss.
+	mu  sync.Mutex
+	gen uint64
+}
+
+// NewReadThrough wraps c; name labels the cache in metrics.
+func NewReadThrough[K comparable, V any](name string, c Cache[K, V]) *ReadThrough[K, V] {
+	return &ReadThrough[K, V]{name: name, c: c}
+}
+
+// Get returns the cached value for key or calls load once for all
+// concurrent callers. Errors are not cached.
+func (r *ReadThrough[K, V]) Get(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	if v, ok := r.c.Get(key); ok {
+		metrics.CacheLookups.WithLabelValues(r.name, "hit").Inc()
+		return v, nil
+	}
+	metrics.CacheLookups.WithLabelValues(r.name, "miss").Inc()
+
+	v, err, _ := r.group.Do(fmt.Sprint(key), func() (any, error) {
+		gen := r.generation()
+		// The shared load must not be cut short by whichever caller
+		// happened to start it.
+		v, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return v, err
+		}
+		r.mu.Lock()
+		if r.gen == gen {
+			r.c.Set(key, v)
+		}
+		r.mu.Unlock()
+		return v, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return v.(V), nil
+}
+
+// Peek returns the cached value for key without loading it.
+func (r *ReadThrough[K, V]) Peek(key K) (V, bool) {
+	v, ok := r.c.Get(key)
+	if ok {
+		metrics.CacheLookups.WithLabelValues(r.name, "hit").Inc()
+	} else {
+		metrics.CacheLookups.WithLabelValues(r.name, "miss").Inc()
+	}
+	return v, ok
+}
+
+// PutIfCurrent stores v under key unless Invalidate was called after gen
+// was taken from Generation.
+func (r *ReadThrough[K, V]) PutIfCurrent(gen uint64, key K, v V) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen == gen {
+		r.c.Set(key, v)
+	}
+}
+
+// Generation is the token PutIfCurrent checks; take it before loading.
+func (r *ReadThrough[K, V]) Generation() uint64 { return r.generation() }
+
+// Invalidate drops key and discards any load for it already in flight.
+func (r *ReadThrough[K, V]) Invalidate(key K) {
+	r.mu.Lock()
+	r.gen++
+	r.c.Delete(key)
+	r.mu.Unlock()
+	r.group.Forget(fmt.Sprint(key))
+}
+
+func (r *ReadThrough[K, V]) generation() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gen
+}
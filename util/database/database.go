@@ -2,20 +2,129 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
+	"instagram/util/logger"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct{ Pool *pgxpool.Pool }
 
-func New(ctx context.Context, dsn string) (*DB, error) {
+// Options tunes the pool. Zero values keep the pgxpool defaults.
+type Options struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	StatementTimeout  time.Duration
+
+	// ConnectRetries is how many extra pings New makes before giving up;
+	// the wait starts at ConnectBackoff and doubles up to maxBackoff.
+	ConnectRetries int
+	ConnectBackoff time.Duration
+
+	// Tracer, when set, observes every query (e.g. tracing.PgxTracer).
+	Tracer pgx.QueryTracer
+}
+
+const maxBackoff = 30 * time.Second
+
+func New(ctx context.Context, dsn string, opt Options) (*DB, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
+	if opt.MaxConns > 0 {
+		cfg.MaxConns = opt.MaxConns
+	}
+	if opt.MinConns > 0 {
+		cfg.MinConns = opt.MinConns
+	}
+	if opt.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opt.MaxConnLifetime
+	}
+	if opt.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = opt.MaxConnIdleTime
+	}
+	if opt.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = opt.HealthCheckPeriod
+	}
+	if opt.StatementTimeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opt.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if opt.Tracer != nil {
+		cfg.ConnConfig.Tracer = opt.Tracer
+	}
+
 	p, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{Pool: p}, nil
+	db := &DB{Pool: p}
+
+	if err := db.connect(ctx, opt.ConnectRetries, opt.ConnectBackoff); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// connect pings until the database answers, backing off between attempts.
+func (db *DB) connect(ctx context.Context, retries int, backoff time.Duration) error {
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = db.Ping(ctx); err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt+1, err)
+		}
+		logger.From(ctx).Warn("database ping failed, retrying", "attempt", attempt+1, "wait", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (db *DB) Ping(ctx context.Context) error { return db.Pool.Ping(ctx) }
+
+// Stats is a JSON-friendly snapshot of pgxpool.Stat.
+type Stats struct {
+	MaxConns             int32  `json:"max_conns"`
+	TotalConns           int32  `json:"total_conns"`
+	AcquiredConns        int32  `json:"acquired_conns"`
+	IdleConns            int32  `json:"idle_conns"`
+	ConstructingConns    int32  `json:"constructing_conns"`
+	AcquireCount         int64  `json:"acquire_count"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	AcquireDuration      string `json:"acquire_duration"`
+}
+
+func (db *DB) Stats() Stats {
+	s := db.Pool.Stat()
+	return Stats{
+		MaxConns:             s.MaxConns(),
+		TotalConns:           s.TotalConns(),
+		AcquiredConns:        s.AcquiredConns(),
+		IdleConns:            s.IdleConns(),
+		ConstructingConns:    s.ConstructingConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AcquireDuration:      s.AcquireDuration().String(),
+	}
 }
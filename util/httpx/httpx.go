@@ -1,23 +1,69 @@
 package httpx
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"syscall"
 	"time"
+
+	"instagram/util/tracing"
 )
 
 var defaultClient = &http.Client{
-	Timeout: 10 * time.Second,
-	Transport: &http.Transport{
+	Timeout:   10 * time.Second,
+	Transport: tracing.Transport(newTransport(nil)),
+}
+
+func Client() *http.Client { return defaultClient }
+
+// ErrForbiddenAddress is returned when an untrusted client is asked to
+// connect to an internal address.
+var ErrForbiddenAddress = errors.New("destination address not allowed")
+
+// UntrustedClient is for URLs supplied by users, such as webhook targets.
+// It doesn't follow redirects and, unless allowPrivate is set, refuses to
+// connect to loopback, private and link-local addresses. The check runs on
+// the resolved address, so DNS names pointing inward are caught too.
+func UntrustedClient(allowPrivate bool) *http.Client {
+	var control func(network, address string, _ syscall.RawConn) error
+	if !allowPrivate {
+		control = publicOnly
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: tracing.Transport(newTransport(control)),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func newTransport(control func(network, address string, c syscall.RawConn) error) *http.Transport {
+	return &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Second,
 			KeepAlive: 30 * time.Second,
+			Control:   control,
 		}).DialContext,
 		MaxIdleConns:        100,
 		MaxConnsPerHost:     100,
 		MaxIdleConnsPerHost: 10,
 		IdleConnTimeout:     90 * time.Second,
-	},
+	}
 }
 
-func Client() *http.Client { return defaultClient }
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	ip := ap.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// ValidMethods are the algorithms tokens may be signed with; anything
+// else, "none" included, is rejected before a key is looked up.
+var ValidMethods = []string{HS256, RS256, EdDSA}
+
+// Key is an asymmetric signing key. Tokens name the key that signed them
+// in the kid header.
+type Key struct {
+	ID      string
+	Alg     string
+	Private crypto.Signer
+	// ActivatesAt is when the key starts signing. Keys are published in
+	// the JWKS before that, so verifiers that cache it see them in time.
+	ActivatesAt time.Time
+}
+
+// GenerateKey creates a key for alg (RS256 or EdDSA) with a random kid.
+func GenerateKey(alg string, activatesAt time.Time) (Key, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case RS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case EdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return Key{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	var kid [12]byte
+	if _, err := rand.Read(kid[:]); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: base64.RawURLEncoding.EncodeToString(kid[:]), Alg: alg, Private: priv, ActivatesAt: activatesAt}, nil
+}
+
+// MarshalPrivate encodes the private key as PKCS #8 DER.
+func (k Key) MarshalPrivate() ([]byte, error) { return x509.MarshalPKCS8PrivateKey(k.Private) }
+
+// ParsePrivate decodes a PKCS #8 DER private key.
+func ParsePrivate(der []byte) (crypto.Signer, error) {
+	p, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := p.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", p)
+	}
+	return s, nil
+}
+
+// JWK is the public half of k.
+func (k Key) JWK() (JWK, error) {
+	j := JWK{Kid: k.ID, Alg: k.Alg, Use: "sig"}
+	switch pub := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		j.Kty, j.Crv = "OKP", "Ed25519"
+		j.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return j, nil
+}
+
+// secretKeyID is the kid of tokens signed with the HS256 secret.
+const secretKeyID = "hs256"
+
+// KeySet signs tokens with the newest active key and verifies them with
+// any key it holds, so rotating keys doesn't invalidate tokens already
+// issued. In HS256 mode it signs and verifies with the shared secret
+// instead and holds no keys; the secret verifies nothing in other modes,
+// so switching away from HS256 signs everyone out.
+type KeySet struct {
+	alg    string
+	secret []byte
+
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewKeySet signs with alg. secret is the HS256 key, only used when alg
+// is HS256.
+func NewKeySet(alg string, secret []byte) *KeySet {
+	return &KeySet{alg: alg, secret: secret, keys: map[string]Key{}}
+}
+
+// Alg is the signing algorithm.
+func (ks *KeySet) Alg() string { return ks.alg }
+
+// Replace swaps in the current keys.
+func (ks *KeySet) Replace(keys []Key) {
+	m := make(map[string]Key, len(keys))
+	for _, k := range keys {
+		m[k.ID] = k
+	}
+	ks.mu.Lock()
+	ks.keys = m
+	ks.mu.Unlock()
+}
+
+// Sign signs claims with the newest key that has activated. After a
+// change of algorithm that may still be a key of the old one, until a
+// key of the new one has been published and activates.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.alg == HS256 {
+		t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		t.Header["kid"] = secretKeyID
+		return t.SignedString(ks.secret)
+	}
+	k, ok := ks.signingKey(time.Now())
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(k.Alg), claims)
+	t.Header["kid"] = k.ID
+	return t.SignedString(k.Private)
+}
+
+func (ks *KeySet) signingKey(now time.Time) (Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var best Key
+	var found bool
+	for _, k := range ks.keys {
+		if k.ActivatesAt.After(now) {
+			continue
+		}
+		if !found || k.ActivatesAt.After(best.ActivatesAt) {
+			best, found = k, true
+		}
+	}
+	return best, found
+}
+
+// Keyfunc resolves the verification key for t from its kid, checking
+// that the token's algorithm is the key's.
+func (ks *KeySet) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key id")
+	}
+	if kid == secretKeyID && ks.alg == HS256 {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("key %q does not sign %s", kid, t.Method.Alg())
+		}
+		return ks.secret, nil
+	}
+	ks.mu.RLock()
+	k, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if t.Method.Alg() != k.Alg {
+		return nil, fmt.Errorf("key %q does not sign %s", kid, t.Method.Alg())
+	}
+	return k.Private.Public(), nil
+}
+
+// JWKS is the public key set, including keys not active yet.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if j, err := k.JWK(); err == nil {
+			set.Keys = append(set.Keys, j)
+		}
+	}
+	return set
+}
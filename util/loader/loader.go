@@ -0,0 +1,119 @@
+// Package loader batches lookups by key so that hydrating a list of rows
+// costs one query per relation instead of one per row.
+package loader
+
+import (
+	"context"
+	"sync"
+)
+
+// FetchFunc loads the values for keys in one round trip. Keys with no
+// value are simply left out of the result.
+type FetchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader caches everything it has fetched, including misses, for its own
+// lifetime. Concurrent loads of the same key may both reach fetch.
+type Loader[K comparable, V any] struct {
+	fetch FetchFunc[K, V]
+
+	mu      sync.Mutex
+	cache   map[K]V
+	missing map[K]struct{}
+}
+
+func New[K comparable, V any](fetch FetchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:   fetch,
+		cache:   map[K]V{},
+		missing: map[K]struct{}{},
+	}
+}
+
+// LoadMany returns the values for keys, fetching the ones not seen yet in
+// a single call.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	l.mu.Lock()
+	var todo []K
+	queued := map[K]struct{}{}
+	for _, k := range keys {
+		if _, ok := l.cache[k]; ok {
+			continue
+		}
+		if _, ok := l.missing[k]; ok {
+			continue
+		}
+		if _, ok := queued[k]; ok {
+			continue
+		}
+		queued[k] = struct{}{}
+		todo = append(todo, k)
+	}
+	l.mu.Unlock()
+
+	if len(todo) > 0 {
+		got, err := l.fetch(ctx, todo)
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		for _, k := range todo {
+			if v, ok := got[k]; ok {
+				l.cache[k] = v
+			} else {
+				l.missing[k] = struct{}{}
+			}
+		}
+		l.mu.Unlock()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[K]V, len(keys))
+	for _, k := range keys {
+		if v, ok := l.cache[k]; ok {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// Load returns the value for k; ok is false when fetch had none.
+func (l *Loader[K, V]) Load(ctx context.Context, k K) (v V, ok bool, err error) {
+	m, err := l.LoadMany(ctx, []K{k})
+	if err != nil {
+		return v, false, err
+	}
+	v, ok = m[k]
+	return v, ok, nil
+}
+
+type scopeKey struct{}
+
+type scope struct {
+	mu      sync.Mutex
+	loaders map[any]any
+}
+
+// WithScope returns a context whose loaders, obtained through For, live as
+// long as the context. The HTTP layer opens one scope per request.
+func WithScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{loaders: map[any]any{}})
+}
+
+// For returns the loader registered under name in ctx's scope, creating it
+// with fetch on first use. Without a scope a fresh loader is returned, so
+// callers batch within one call but share nothing.
+func For[K comparable, V any](ctx context.Context, name any, fetch FetchFunc[K, V]) *Loader[K, V] {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return New(fetch)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.loaders[name].(*Loader[K, V]); ok {
+		return l
+	}
+	l := New(fetch)
+	s.loaders[name] = l
+	return l
+}
@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// Options configures the process-wide handler.
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+}
+
+// New builds a logger that writes to w and redacts sensitive attributes.
+func New(w io.Writer, opt Options) *slog.Logger {
+	ho := &slog.HandlerOptions{
+		Level:       parseLevel(opt.Level),
+		ReplaceAttr: redact,
+	}
+	if strings.EqualFold(opt.Format, "text") {
+		return slog.New(slog.NewTextHandler(w, ho))
+	}
+	return slog.New(slog.NewJSONHandler(w, ho))
+}
+
+func parseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// With stores l in ctx for From to find.
+func With(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// From returns the request-scoped logger, or slog.Default outside a request.
+func From(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// Append returns ctx whose logger carries the extra key/value pairs.
+func Append(ctx context.Context, args ...any) context.Context {
+	return With(ctx, From(ctx).With(args...))
+}
+
+const redacted = "[REDACTED]"
+
+var sensitive = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"password":      true,
+	"password_hash": true,
+	"token":         true,
+	"secret":        true,
+	"api_key":       true,
+	"x-api-key":     true,
+}
+
+// redact blanks credentials outright and masks emails down to their first
+// character and domain, so logs stay useful for support without leaking
+// who the user is.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case sensitive[key]:
+		return slog.String(a.Key, redacted)
+	case key == "email":
+		return slog.String(a.Key, maskEmail(a.Value.String()))
+	}
+	return a
+}
+
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 {
+		return redacted
+	}
+	return s[:1] + "***" + s[at:]
+}
@@ -0,0 +1,298 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization-code flow with PKCE and ID token verification.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwtutil "instagram/util/jwt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Config struct {
+	// Issuer is the provider's issuer URL exactly as it puts it in tokens;
+	// discovery is fetched from Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+}
+
+// Claims are the ID token claims used to find or create a user.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+// ErrProvider wraps failures reported by, or caused by, the provider.
+var ErrProvider = errors.New("oidc provider error")
+
+const (
+	// keysMinRefresh stops a stream of tokens with unknown kids from
+	// hammering the JWKS endpoint.
+	keysMinRefresh = time.Minute
+	leeway         = time.Minute
+)
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one OpenID provider. Discovery and keys are fetched
+// on first use and cached, so the app starts even when the provider is
+// down.
+type Provider struct {
+	cfg Config
+
+	mu       sync.Mutex
+	meta     *metadata
+	keys     jwtutil.JWKS
+	keysTime time.Time
+}
+
+func New(cfg Config) *Provider {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &Provider{cfg: cfg}
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string) {
+	verifier = RandomString()
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns 256 random bits, URL-safe encoded, for states,
+// nonces and verifiers.
+func RandomString() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// AuthURL is where to send the browser to sign in.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims
+// of the ID token that comes with it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &tok)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("%w: token endpoint: %d %s %s", ErrProvider, status, tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrProvider)
+	}
+	return p.Verify(ctx, tok.IDToken, nonce)
+}
+
+// Verify checks an ID token's signature against the provider's JWKS and
+// its iss, aud, azp, exp, iat and nonce claims.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var mc jwt.MapClaims
+	_, err = jwt.ParseWithClaims(raw, &mc, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(m.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id_token: %w", ErrProvider, err)
+	}
+	if got, _ := mc["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: id_token: nonce mismatch", ErrProvider)
+	}
+	if aud, _ := mc.GetAudience(); len(aud) > 1 {
+		if azp, _ := mc["azp"].(string); azp != p.cfg.ClientID {
+			return nil, fmt.Errorf("%w: id_token: azp mismatch", ErrProvider)
+		}
+	}
+
+	c := &Claims{}
+	c.Subject, _ = mc.GetSubject()
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: id_token: no subject", ErrProvider)
+	}
+	c.Email, _ = mc["email"].(string)
+	c.Name, _ = mc["name"].(string)
+	c.GivenName, _ = mc["given_name"].(string)
+	c.FamilyName, _ = mc["family_name"].(string)
+	c.PreferredUsername, _ = mc["preferred_username"].(string)
+	// Some providers send the boolean as a string.
+	switch v := mc["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+	return c, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var m metadata
+	status, err := p.do(req, &m)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: discovery: HTTP %d", ErrProvider, status)
+	}
+	if m.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: discovery: issuer %q does not match %q", ErrProvider, m.Issuer, p.cfg.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery: missing endpoints", ErrProvider)
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// key returns the provider's verification key kid, refetching the JWKS
+// when kid is unknown, since that is what a key rotation looks like.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.find(kid); ok {
+		return k.PublicKey()
+	}
+	if time.Since(p.keysTime) < keysMinRefresh {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwtutil.JWKS
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jwks: HTTP %d", status)
+	}
+	p.keys, p.keysTime = set, time.Now()
+	if k, ok := p.find(kid); ok {
+		return k.PublicKey()
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// find looks kid up in the cached set. An empty kid matches the only
+// key, for providers that publish just one without an ID.
+func (p *Provider) find(kid string) (jwtutil.JWK, bool) {
+	if kid == "" && len(p.keys.Keys) == 1 {
+		return p.keys.Keys[0], true
+	}
+	return p.keys.Find(kid)
+}
+
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrProvider, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: decode %s: %w", ErrProvider, req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// Issuer identifies the provider in stored identities.
+func (p *Provider) Issuer() string { return p.cfg.Issuer }